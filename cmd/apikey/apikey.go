@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/database"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/dto"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/repository"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/validator"
+)
+
+// Usage:
+//
+//	go run ./cmd/apikey -create -name recruitment-be -applications RECRUITMENT [-created-by <uuid>,<uuid>]
+//	go run ./cmd/apikey -list
+//	go run ./cmd/apikey -revoke <api key id>
+func main() {
+	create := flag.Bool("create", false, "create a new api key")
+	list := flag.Bool("list", false, "list api keys")
+	revoke := flag.String("revoke", "", "revoke the api key with the given id")
+	name := flag.String("name", "", "name of the producing service")
+	applications := flag.String("applications", "", "comma separated applications the key may create notifications for")
+	createdBy := flag.String("created-by", "", "comma separated created_by user IDs the key may claim, empty allows any")
+	flag.Parse()
+
+	config := config.GetConfig()
+	logger := logger.NewLogger()
+	db := database.NewPostgresDatabase(config)
+	validator := validator.NewValidatorV10(config)
+
+	apiKeyRepository := repository.NewApiKeyRepository(db, logger)
+	apiKeyDTO := dto.NewApiKeyDTO(logger)
+	apiKeyUseCase := usecase.NewApiKeyUseCase(logger, apiKeyDTO, apiKeyRepository)
+
+	switch {
+	case *create:
+		req := &request.CreateApiKeyRequest{
+			Name:             *name,
+			Applications:     splitFlag(*applications),
+			AllowedCreatedBy: splitFlag(*createdBy),
+		}
+		if err := validator.GetValidator().Struct(req); err != nil {
+			logger.GetLogger().Fatal("Validation error: ", err)
+		}
+
+		res, err := apiKeyUseCase.CreateApiKey(req)
+		if err != nil {
+			logger.GetLogger().Fatal("Failed to create api key: ", err)
+		}
+		fmt.Printf("id: %s\nkey: %s\n", res.ID, res.Key)
+		fmt.Println("Store this key now, it cannot be shown again.")
+	case *list:
+		apiKeys, err := apiKeyUseCase.GetAllApiKeys()
+		if err != nil {
+			logger.GetLogger().Fatal("Failed to list api keys: ", err)
+		}
+		for _, apiKey := range apiKeys {
+			status := "active"
+			if apiKey.RevokedAt != nil {
+				status = "revoked"
+			}
+			fmt.Printf("%s\t%s\t%s...\t%s\t%s\n", apiKey.ID, apiKey.Name, apiKey.Prefix, strings.Join(apiKey.Applications, ","), status)
+		}
+	case *revoke != "":
+		if err := apiKeyUseCase.RevokeApiKey(*revoke); err != nil {
+			logger.GetLogger().Fatal("Failed to revoke api key: ", err)
+		}
+		logger.GetLogger().Info("Api key revoked successfully")
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+}
+
+func splitFlag(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
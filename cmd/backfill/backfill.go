@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/database"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/dto"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/messaging"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/rabbitmq"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/repository"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/google/uuid"
+)
+
+// Usage:
+//
+//	go run ./cmd/backfill [-batch-size 500]
+//
+// Fills user_name and created_by_name on notifications created before the
+// names were stored. SSO replies are consumed from a temporary queue so the
+// running service keeps its own queue.
+func main() {
+	batchSize := flag.Int("batch-size", 500, "number of notifications resolved per find_users_by_ids request")
+	flag.Parse()
+
+	config := config.GetConfig()
+	logger := logger.NewLogger()
+	db := database.NewPostgresDatabase(config)
+
+	manager := rabbitmq.NewConnectionManager(*config, logger)
+	go manager.Run()
+	go rabbitmq.InitProducer(logger, manager)
+
+	rpcClient, err := rabbitmq.NewReplyConsumer(manager.Connection(), logger, time.Duration(config.RabbitMq.RpcTimeout)*time.Second)
+	if err != nil {
+		logger.GetLogger().Fatal("Failed to consume SSO replies: ", err)
+	}
+
+	notificationRepository := repository.NewNotificationRepository(db, logger)
+	notificationDTO := dto.NewNotificationDTO(logger, messaging.NewUserMessage(logger, rpcClient))
+
+	var updated, skipped int
+	cursor := uuid.Nil
+	for {
+		notifications, err := notificationRepository.GetNotificationsWithoutUserNames(cursor, *batchSize)
+		if err != nil {
+			logger.GetLogger().Fatal("Failed to get notifications: ", err)
+		}
+		if len(notifications) == 0 {
+			break
+		}
+		cursor = notifications[len(notifications)-1].ID
+
+		notificationDTO.FillUserNames(context.Background(), notifications)
+		for _, notification := range notifications {
+			if notification.UserName == "" && notification.CreatedByName == "" {
+				skipped++
+				continue
+			}
+			if err := notificationRepository.UpdateUserNames(notification.ID, notification.UserName, notification.CreatedByName); err != nil {
+				logger.GetLogger().Fatal("Failed to update notification: ", err)
+			}
+			updated++
+		}
+		logger.GetLogger().Infof("Backfilled %d notifications, %d unresolved so far", updated, skipped)
+	}
+
+	logger.GetLogger().Infof("Backfill finished: %d notifications updated, %d unresolved", updated, skipped)
+}
@@ -15,6 +15,8 @@ func main() {
 	// Initialize the database connection
 	if err := db.GetDb().AutoMigrate(
 		&entity.Notification{},
+		&entity.ApiKey{},
+		&entity.IdempotencyKey{},
 	); err != nil {
 		logger.GetLogger().Fatal("Failed to migrate database", err)
 	}
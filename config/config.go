@@ -9,11 +9,15 @@ import (
 
 type (
 	Config struct {
-		Server   *Server
-		Db       *Db
-		Session  *Session
-		Csrf     *Csrf
-		RabbitMq *RabbitMq `mapstructure:"rabbitmq"`
+		Server      *Server
+		Db          *Db
+		Session     *Session
+		Csrf        *Csrf
+		RabbitMq    *RabbitMq    `mapstructure:"rabbitmq"`
+		Jwt         *Jwt         `mapstructure:"jwt"`
+		UserCache   *UserCache   `mapstructure:"user_cache"`
+		Idempotency *Idempotency `mapstructure:"idempotency"`
+		Websocket   *Websocket   `mapstructure:"websocket"`
 	}
 
 	Server struct {
@@ -47,8 +51,41 @@ type (
 	}
 
 	RabbitMq struct {
-		Host  string `mapstructure:"host"`
-		Queue string `mapstructure:"queue"`
+		Host       string `mapstructure:"host"`
+		Queue      string `mapstructure:"queue"`
+		RpcTimeout int    `mapstructure:"rpc_timeout"` // in seconds
+		MaxRetries int    `mapstructure:"max_retries"` // attempts before a message is dead-lettered
+		RetryDelay int    `mapstructure:"retry_delay"` // in seconds before the first retry, doubled for every further one
+		Prefetch   int    `mapstructure:"prefetch"`    // unacked deliveries the broker hands the consumer
+		Workers    int    `mapstructure:"workers"`     // deliveries handled concurrently
+	}
+
+	Jwt struct {
+		Secret    string `mapstructure:"secret"`
+		PublicKey string `mapstructure:"public_key"`
+		Issuer    string `mapstructure:"issuer"`
+	}
+
+	UserCache struct {
+		Size          int `mapstructure:"size"`
+		Ttl           int `mapstructure:"ttl"`            // in seconds
+		NegativeTtl   int `mapstructure:"negative_ttl"`   // in seconds
+		CreateTimeout int `mapstructure:"create_timeout"` // in seconds, name lookups made while creating notifications
+	}
+
+	Idempotency struct {
+		Ttl           int `mapstructure:"ttl"`            // in seconds
+		PurgeInterval int `mapstructure:"purge_interval"` // in seconds, how often expired keys are deleted
+	}
+
+	Websocket struct {
+		Backplane       string `mapstructure:"backplane"`        // "local" or "rabbitmq"
+		PingInterval    int    `mapstructure:"ping_interval"`    // in seconds
+		PongWait        int    `mapstructure:"pong_wait"`        // in seconds
+		WriteWait       int    `mapstructure:"write_wait"`       // in seconds
+		MaxMessageSize  int64  `mapstructure:"max_message_size"` // in bytes
+		BroadcastBuffer int    `mapstructure:"broadcast_buffer"`
+		OverflowPolicy  string `mapstructure:"overflow_policy"` // disconnect, drop_oldest or coalesce
 	}
 )
 
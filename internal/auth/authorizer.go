@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrForbidden is returned when the caller may not perform the operation at all.
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound is returned both for missing notifications and for notifications
+	// the caller does not own, so that IDs of other users cannot be probed.
+	ErrNotFound = errors.New("notification not found")
+)
+
+type INotificationAuthorizer interface {
+	AuthorizeCreate(principal *Principal, application string, createdBy uuid.UUID) error
+	AuthorizeNotification(principal *Principal, ent *entity.Notification) error
+	AuthorizeUser(principal *Principal, userID uuid.UUID) error
+	AuthorizeListAll(principal *Principal) error
+	AuthorizeApplication(principal *Principal, application string) error
+	ScopeKeys(principal *Principal, keys map[string]interface{}) error
+}
+
+type NotificationAuthorizer struct {
+	log logger.Logger
+}
+
+func NewNotificationAuthorizer(log logger.Logger) INotificationAuthorizer {
+	return &NotificationAuthorizer{
+		log: log,
+	}
+}
+
+func NotificationAuthorizerFactory(log logger.Logger) INotificationAuthorizer {
+	return NewNotificationAuthorizer(log)
+}
+
+// AuthorizeCreate only lets services and admins produce notifications, and
+// keeps services within the applications and senders their key was issued for.
+func (a *NotificationAuthorizer) AuthorizeCreate(principal *Principal, application string, createdBy uuid.UUID) error {
+	if principal == nil || principal.Role == RoleUser {
+		return ErrForbidden
+	}
+
+	if !principal.CanAccessApplication(application) {
+		a.log.GetLogger().Warn("Service denied creating notification for application ", "api_key_id", principal.ApiKeyID, "application", application)
+		return ErrForbidden
+	}
+
+	if !principal.CanClaimCreatedBy(createdBy) {
+		a.log.GetLogger().Warn("Service denied claiming created_by ", "api_key_id", principal.ApiKeyID, "created_by", createdBy)
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func (a *NotificationAuthorizer) AuthorizeNotification(principal *Principal, ent *entity.Notification) error {
+	if principal == nil {
+		return ErrForbidden
+	}
+
+	switch principal.Role {
+	case RoleAdmin:
+		return nil
+	case RoleService:
+		if !principal.CanAccessApplication(ent.Application) {
+			a.log.GetLogger().Warn("Service denied access to notification ", "notification_id", ent.ID, "application", ent.Application)
+			return ErrNotFound
+		}
+		return nil
+	default:
+		if ent.UserID != principal.UserID {
+			a.log.GetLogger().Warn("User denied access to notification ", "notification_id", ent.ID, "user_id", principal.UserID)
+			return ErrNotFound
+		}
+		return nil
+	}
+}
+
+func (a *NotificationAuthorizer) AuthorizeUser(principal *Principal, userID uuid.UUID) error {
+	if principal == nil {
+		return ErrForbidden
+	}
+
+	if principal.Role == RoleUser && principal.UserID != userID {
+		a.log.GetLogger().Warn("User denied access to notifications of another user ", "user_id", principal.UserID, "target_user_id", userID)
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (a *NotificationAuthorizer) AuthorizeListAll(principal *Principal) error {
+	if principal == nil || !principal.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AuthorizeApplication guards bulk operations that span users, which only
+// services of that application and admins may run.
+func (a *NotificationAuthorizer) AuthorizeApplication(principal *Principal, application string) error {
+	if principal == nil || principal.Role == RoleUser {
+		return ErrForbidden
+	}
+
+	if !principal.CanAccessApplication(application) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// ScopeKeys narrows repository filter keys to the rows the principal may see.
+// End users are pinned to their own user_id and services to their applications.
+func (a *NotificationAuthorizer) ScopeKeys(principal *Principal, keys map[string]interface{}) error {
+	if principal == nil {
+		return ErrForbidden
+	}
+
+	switch principal.Role {
+	case RoleAdmin:
+		return nil
+	case RoleService:
+		if application, ok := keys["application"].(string); ok {
+			if !principal.CanAccessApplication(application) {
+				return ErrForbidden
+			}
+		} else if applications, ok := keys["application"].([]string); ok {
+			for _, application := range applications {
+				if !principal.CanAccessApplication(application) {
+					return ErrForbidden
+				}
+			}
+		} else if !principal.HasAllApplications() {
+			if len(principal.Applications) == 0 {
+				return ErrForbidden
+			}
+			keys["application"] = principal.Applications
+		}
+		return nil
+	default:
+		if userID, ok := keys["user_id"]; ok && fmt.Sprint(userID) != principal.UserID.String() {
+			return ErrForbidden
+		}
+		keys["user_id"] = principal.UserID.String()
+		return nil
+	}
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/google/uuid"
+)
+
+func newTestAuthorizer() INotificationAuthorizer {
+	return NewNotificationAuthorizer(logger.NewLogger())
+}
+
+func servicePrincipal(applications ...string) *Principal {
+	return &Principal{Role: RoleService, Applications: applications}
+}
+
+func TestAuthorizeCreate(t *testing.T) {
+	a := newTestAuthorizer()
+	createdBy := uuid.New()
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		want      error
+	}{
+		{"nil principal", nil, ErrForbidden},
+		{"user", NewUserPrincipal(createdBy), ErrForbidden},
+		{"admin", &Principal{Role: RoleAdmin}, nil},
+		{"service without applications", servicePrincipal(), ErrForbidden},
+		{"service of every application", servicePrincipal(AllApplications), nil},
+		{"system", NewSystemPrincipal(), nil},
+		{"service of the application", servicePrincipal("mpp"), nil},
+		{"service of another application", servicePrincipal("recruitment"), ErrForbidden},
+		{"service allowed created_by", &Principal{Role: RoleService, Applications: []string{"mpp"}, AllowedCreatedBy: []uuid.UUID{createdBy}}, nil},
+		{"service other created_by", &Principal{Role: RoleService, Applications: []string{"mpp"}, AllowedCreatedBy: []uuid.UUID{uuid.New()}}, ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := a.AuthorizeCreate(tt.principal, "mpp", createdBy); !errors.Is(err, tt.want) {
+				t.Fatalf("AuthorizeCreate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeNotification(t *testing.T) {
+	a := newTestAuthorizer()
+	owner := uuid.New()
+	ent := &entity.Notification{ID: uuid.New(), UserID: owner, Application: "mpp"}
+
+	tests := []struct {
+		name      string
+		principal *Principal
+		want      error
+	}{
+		{"nil principal", nil, ErrForbidden},
+		{"owner", NewUserPrincipal(owner), nil},
+		{"other user", NewUserPrincipal(uuid.New()), ErrNotFound},
+		{"admin", &Principal{Role: RoleAdmin}, nil},
+		{"service of the application", servicePrincipal("mpp"), nil},
+		{"service of another application", servicePrincipal("recruitment"), ErrNotFound},
+		{"service without applications", servicePrincipal(), ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := a.AuthorizeNotification(tt.principal, ent); !errors.Is(err, tt.want) {
+				t.Fatalf("AuthorizeNotification() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeUserAndListAll(t *testing.T) {
+	a := newTestAuthorizer()
+	userID := uuid.New()
+
+	if err := a.AuthorizeUser(NewUserPrincipal(userID), userID); err != nil {
+		t.Fatalf("own user: %v", err)
+	}
+	if err := a.AuthorizeUser(NewUserPrincipal(userID), uuid.New()); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("other user: %v", err)
+	}
+	if err := a.AuthorizeUser(servicePrincipal("mpp"), uuid.New()); err != nil {
+		t.Fatalf("service: %v", err)
+	}
+
+	if err := a.AuthorizeListAll(&Principal{Role: RoleAdmin}); err != nil {
+		t.Fatalf("admin list all: %v", err)
+	}
+	for _, principal := range []*Principal{nil, NewUserPrincipal(userID), servicePrincipal()} {
+		if err := a.AuthorizeListAll(principal); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("list all by %+v: %v", principal, err)
+		}
+	}
+}
+
+func TestAuthorizeApplication(t *testing.T) {
+	a := newTestAuthorizer()
+
+	if err := a.AuthorizeApplication(NewUserPrincipal(uuid.New()), "mpp"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("user: %v", err)
+	}
+	if err := a.AuthorizeApplication(servicePrincipal("recruitment"), "mpp"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("service of another application: %v", err)
+	}
+	if err := a.AuthorizeApplication(servicePrincipal("mpp"), "mpp"); err != nil {
+		t.Fatalf("service of the application: %v", err)
+	}
+}
+
+func TestScopeKeys(t *testing.T) {
+	a := newTestAuthorizer()
+	userID := uuid.New()
+
+	t.Run("user is pinned to own user_id", func(t *testing.T) {
+		keys := map[string]interface{}{}
+		if err := a.ScopeKeys(NewUserPrincipal(userID), keys); err != nil {
+			t.Fatal(err)
+		}
+		if keys["user_id"] != userID.String() {
+			t.Fatalf("user_id = %v", keys["user_id"])
+		}
+	})
+
+	t.Run("user may pass own user_id as uuid", func(t *testing.T) {
+		keys := map[string]interface{}{"user_id": userID}
+		if err := a.ScopeKeys(NewUserPrincipal(userID), keys); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("user may not ask for another user", func(t *testing.T) {
+		keys := map[string]interface{}{"user_id": uuid.NewString()}
+		if err := a.ScopeKeys(NewUserPrincipal(userID), keys); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("ScopeKeys() = %v", err)
+		}
+	})
+
+	t.Run("restricted service is pinned to its applications", func(t *testing.T) {
+		keys := map[string]interface{}{}
+		if err := a.ScopeKeys(servicePrincipal("mpp", "onboarding"), keys); err != nil {
+			t.Fatal(err)
+		}
+		applications, _ := keys["application"].([]string)
+		if len(applications) != 2 {
+			t.Fatalf("application = %v", keys["application"])
+		}
+	})
+
+	t.Run("service may not ask for another application", func(t *testing.T) {
+		for _, application := range []interface{}{"recruitment", []string{"mpp", "recruitment"}} {
+			keys := map[string]interface{}{"application": application}
+			if err := a.ScopeKeys(servicePrincipal("mpp"), keys); !errors.Is(err, ErrForbidden) {
+				t.Fatalf("ScopeKeys(%v) = %v", application, err)
+			}
+		}
+	})
+
+	t.Run("service without applications sees nothing", func(t *testing.T) {
+		if err := a.ScopeKeys(servicePrincipal(), map[string]interface{}{}); !errors.Is(err, ErrForbidden) {
+			t.Fatalf("ScopeKeys() = %v", err)
+		}
+	})
+
+	t.Run("service of every application is not narrowed", func(t *testing.T) {
+		keys := map[string]interface{}{}
+		if err := a.ScopeKeys(servicePrincipal(AllApplications), keys); err != nil || len(keys) != 0 {
+			t.Fatalf("ScopeKeys() = %v, keys %v", err, keys)
+		}
+	})
+
+	t.Run("admin keys are left alone", func(t *testing.T) {
+		keys := map[string]interface{}{}
+		if err := a.ScopeKeys(&Principal{Role: RoleAdmin}, keys); err != nil || len(keys) != 0 {
+			t.Fatalf("ScopeKeys() = %v, keys %v", err, keys)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"github.com/google/uuid"
+)
+
+type Role string
+
+const (
+	// RoleUser is an end user acting on their own notifications.
+	RoleUser Role = "USER"
+	// RoleService is a backend that produces notifications for one or more applications.
+	RoleService Role = "SERVICE"
+	// RoleAdmin can read and modify every notification.
+	RoleAdmin Role = "ADMIN"
+)
+
+// AllApplications in Principal.Applications grants a service every
+// application.
+const AllApplications = "*"
+
+// Principal is the authenticated caller of a use case method.
+type Principal struct {
+	UserID           uuid.UUID
+	Role             Role
+	Applications     []string    // applications a service may act on, empty means none
+	AllowedCreatedBy []uuid.UUID // created_by values a service may claim, empty means any
+	ApiKeyID         uuid.UUID   // set when the service authenticated with an API key
+}
+
+func NewUserPrincipal(userID uuid.UUID) *Principal {
+	return &Principal{
+		UserID: userID,
+		Role:   RoleUser,
+	}
+}
+
+// NewSystemPrincipal is used for trusted internal callers, which are not
+// bound to an application or sender.
+func NewSystemPrincipal() *Principal {
+	return &Principal{
+		Role:         RoleService,
+		Applications: []string{AllApplications},
+	}
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.Role == RoleAdmin
+}
+
+func (p *Principal) IsService() bool {
+	return p.Role == RoleService
+}
+
+// HasAllApplications reports whether a service was granted every application
+// through the AllApplications wildcard.
+func (p *Principal) HasAllApplications() bool {
+	for _, app := range p.Applications {
+		if app == AllApplications {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) CanAccessApplication(application string) bool {
+	switch p.Role {
+	case RoleAdmin:
+		return true
+	case RoleService:
+		for _, app := range p.Applications {
+			if app == application || app == AllApplications {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *Principal) CanClaimCreatedBy(createdBy uuid.UUID) bool {
+	switch p.Role {
+	case RoleAdmin:
+		return true
+	case RoleService:
+		if len(p.AllowedCreatedBy) == 0 {
+			return true
+		}
+		for _, id := range p.AllowedCreatedBy {
+			if id == createdBy {
+				return true
+			}
+		}
+		return false
+	default:
+		return p.UserID == createdBy
+	}
+}
@@ -0,0 +1,34 @@
+package dto
+
+import (
+	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+)
+
+type IApiKeyDTO interface {
+	ConvertEntityToResponse(ent *entity.ApiKey) *response.ApiKeyResponse
+}
+
+type ApiKeyDTO struct {
+	log logger.Logger
+}
+
+func NewApiKeyDTO(log logger.Logger) IApiKeyDTO {
+	return &ApiKeyDTO{
+		log: log,
+	}
+}
+
+func (d *ApiKeyDTO) ConvertEntityToResponse(ent *entity.ApiKey) *response.ApiKeyResponse {
+	return &response.ApiKeyResponse{
+		ID:               ent.ID,
+		Name:             ent.Name,
+		Prefix:           ent.Prefix,
+		Applications:     ent.GetApplications(),
+		AllowedCreatedBy: ent.GetAllowedCreatedBy(),
+		RevokedAt:        ent.RevokedAt,
+		CreatedAt:        ent.CreatedAt,
+		UpdatedAt:        ent.UpdatedAt,
+	}
+}
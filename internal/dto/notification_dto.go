@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"context"
+
 	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/messaging"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
@@ -9,9 +11,14 @@ import (
 	"github.com/IlhamSetiaji/julong-notification-be/logger"
 )
 
+const unknownUserName = "Unknown"
+
 type INotificationDTO interface {
-	ConvertEntityToResponse(ent *entity.Notification) *response.NotificationResponse
-	ConvertEntityToWebsocketResponse(ent *entity.Notification) *websocket.WsNotification
+	ConvertEntityToResponse(ctx context.Context, ent *entity.Notification) *response.NotificationResponse
+	ConvertEntitiesToResponses(ctx context.Context, ents []entity.Notification) []response.NotificationResponse
+	ConvertEntityToWebsocketResponse(ctx context.Context, ent *entity.Notification) *websocket.WsNotification
+	ConvertEntitiesToWebsocketResponses(ctx context.Context, ents []entity.Notification) []websocket.WsNotification
+	FillUserNames(ctx context.Context, ents []entity.Notification)
 }
 
 type NotificationDTO struct {
@@ -26,30 +33,40 @@ func NewNotificationDTO(log logger.Logger, userMessage messaging.IUserMessage) I
 	}
 }
 
-func (n *NotificationDTO) ConvertEntityToResponse(ent *entity.Notification) *response.NotificationResponse {
-	var userName string
-	var createdByName string
-	user, err := n.userMessage.SendFindUserByIDMessage(request.SendFindUserByIDMessageRequest{
-		ID: ent.UserID.String(),
-	})
-	if err != nil {
-		n.log.GetLogger().Error("Failed to find user by ID: ", "error", err)
-		userName = "Unknown"
-	} else {
-		userName = user.Name
+func (n *NotificationDTO) ConvertEntityToResponse(ctx context.Context, ent *entity.Notification) *response.NotificationResponse {
+	userNames := n.findUserNames(ctx, []entity.Notification{*ent})
+	return convertEntityToResponse(ent, userNames)
+}
+
+// ConvertEntitiesToResponses resolves the names of every recipient and sender
+// on the page with a single batch lookup.
+func (n *NotificationDTO) ConvertEntitiesToResponses(ctx context.Context, ents []entity.Notification) []response.NotificationResponse {
+	userNames := n.findUserNames(ctx, ents)
+
+	var responses []response.NotificationResponse
+	for i := range ents {
+		responses = append(responses, *convertEntityToResponse(&ents[i], userNames))
 	}
+	return responses
+}
 
-	createdBy, err := n.userMessage.SendFindUserByIDMessage(request.SendFindUserByIDMessageRequest{
-		ID: ent.CreatedBy.String(),
-	})
-	if err != nil {
-		n.log.GetLogger().Error("Failed to find user by ID: ", "error", err)
-		createdByName = "Unknown"
-	} else {
-		createdByName = createdBy.Name
+func (n *NotificationDTO) ConvertEntityToWebsocketResponse(ctx context.Context, ent *entity.Notification) *websocket.WsNotification {
+	userNames := n.findUserNames(ctx, []entity.Notification{*ent})
+	return convertEntityToWebsocketResponse(ent, userNames)
+}
+
+func (n *NotificationDTO) ConvertEntitiesToWebsocketResponses(ctx context.Context, ents []entity.Notification) []websocket.WsNotification {
+	userNames := n.findUserNames(ctx, ents)
+
+	notifications := make([]websocket.WsNotification, 0, len(ents))
+	for i := range ents {
+		notifications = append(notifications, *convertEntityToWebsocketResponse(&ents[i], userNames))
 	}
+	return notifications
+}
 
-	return &response.NotificationResponse{
+func convertEntityToWebsocketResponse(ent *entity.Notification, userNames map[string]string) *websocket.WsNotification {
+	return &websocket.WsNotification{
 		ID:            ent.ID,
 		Application:   ent.Application,
 		Name:          ent.Name,
@@ -58,37 +75,73 @@ func (n *NotificationDTO) ConvertEntityToResponse(ent *entity.Notification) *res
 		Message:       ent.Message,
 		UserID:        ent.UserID,
 		CreatedBy:     ent.CreatedBy,
-		UserName:      userName,
-		CreatedByName: createdByName,
+		UserName:      userName(userNames, ent.UserID.String(), ent.UserName),
+		CreatedByName: userName(userNames, ent.CreatedBy.String(), ent.CreatedByName),
+		SourceType:    ent.SourceType,
+		SourceID:      ent.SourceID,
+		UnreadCount:   ent.UnreadCount,
 		CreatedAt:     ent.CreatedAt,
 		UpdatedAt:     ent.UpdatedAt,
 	}
 }
 
-func (n *NotificationDTO) ConvertEntityToWebsocketResponse(ent *entity.Notification) *websocket.WsNotification {
-	var userName string
-	var createdByName string
-	user, err := n.userMessage.SendFindUserByIDMessage(request.SendFindUserByIDMessageRequest{
-		ID: ent.UserID.String(),
-	})
-	if err != nil {
-		n.log.GetLogger().Error("Failed to find user by ID: ", "error", err)
-		userName = "Unknown"
-	} else {
-		userName = user.Name
+// FillUserNames stores the current recipient and sender names on ents that
+// do not have them yet. Names that cannot be resolved stay empty so that the
+// read path falls back to a lookup later.
+func (n *NotificationDTO) FillUserNames(ctx context.Context, ents []entity.Notification) {
+	userNames := n.findUserNames(ctx, ents)
+	for i := range ents {
+		if ents[i].UserName == "" {
+			ents[i].UserName = userNames[ents[i].UserID.String()]
+		}
+		if ents[i].CreatedByName == "" {
+			ents[i].CreatedByName = userNames[ents[i].CreatedBy.String()]
+		}
+	}
+}
+
+// findUserNames looks up the user_id and created_by values of ents whose name
+// was not stored at creation time. Users that cannot be resolved are left out.
+func (n *NotificationDTO) findUserNames(ctx context.Context, ents []entity.Notification) map[string]string {
+	seen := make(map[string]bool)
+	var ids []string
+	addID := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, ent := range ents {
+		if ent.UserName == "" {
+			addID(ent.UserID.String())
+		}
+		if ent.CreatedByName == "" {
+			addID(ent.CreatedBy.String())
+		}
 	}
 
-	createdBy, err := n.userMessage.SendFindUserByIDMessage(request.SendFindUserByIDMessageRequest{
-		ID: ent.CreatedBy.String(),
+	userNames := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return userNames
+	}
+
+	users, err := n.userMessage.SendFindUsersByIDsMessage(ctx, request.SendFindUsersByIDsMessageRequest{
+		IDs: ids,
 	})
 	if err != nil {
-		n.log.GetLogger().Error("Failed to find user by ID: ", "error", err)
-		createdByName = "Unknown"
-	} else {
-		createdByName = createdBy.Name
+		n.log.GetLogger().Error("Failed to find users by IDs: ", "error", err)
+	}
+	if users != nil {
+		for _, user := range users.Users {
+			userNames[user.ID] = user.Name
+		}
 	}
 
-	return &websocket.WsNotification{
+	return userNames
+}
+
+func convertEntityToResponse(ent *entity.Notification, userNames map[string]string) *response.NotificationResponse {
+	return &response.NotificationResponse{
 		ID:            ent.ID,
 		Application:   ent.Application,
 		Name:          ent.Name,
@@ -97,10 +150,22 @@ func (n *NotificationDTO) ConvertEntityToWebsocketResponse(ent *entity.Notificat
 		Message:       ent.Message,
 		UserID:        ent.UserID,
 		CreatedBy:     ent.CreatedBy,
-		UserName:      userName,
-		CreatedByName: createdByName,
-		UnreadCount:   ent.UnreadCount,
+		UserName:      userName(userNames, ent.UserID.String(), ent.UserName),
+		CreatedByName: userName(userNames, ent.CreatedBy.String(), ent.CreatedByName),
+		SourceType:    ent.SourceType,
+		SourceID:      ent.SourceID,
 		CreatedAt:     ent.CreatedAt,
 		UpdatedAt:     ent.UpdatedAt,
 	}
 }
+
+// userName prefers the name stored on the notification over a lookup.
+func userName(userNames map[string]string, userID string, stored string) string {
+	if stored != "" {
+		return stored
+	}
+	if name, ok := userNames[userID]; ok {
+		return name
+	}
+	return unknownUserName
+}
@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ApiKey is a credential issued to a backend that produces notifications.
+// Only the SHA-256 hash of the key is stored.
+type ApiKey struct {
+	gorm.Model       `json:"-"`
+	ID               uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	Name             string     `json:"name" gorm:"type:varchar(255);not null"`
+	Prefix           string     `json:"prefix" gorm:"type:varchar(16);not null"`
+	KeyHash          string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	Applications     string     `json:"applications" gorm:"type:text;not null"`
+	AllowedCreatedBy string     `json:"allowed_created_by" gorm:"type:text"`
+	RevokedAt        *time.Time `json:"revoked_at" gorm:"type:timestamp"`
+}
+
+func (a *ApiKey) BeforeCreate(tx *gorm.DB) (err error) {
+	a.ID = uuid.New()
+	loc := time.FixedZone("Asia/Jakarta", 7*60*60)
+	a.CreatedAt = time.Now().In(loc)
+	a.UpdatedAt = time.Now().In(loc)
+	return
+}
+
+func (a *ApiKey) BeforeUpdate(tx *gorm.DB) (err error) {
+	loc := time.FixedZone("Asia/Jakarta", 7*60*60)
+	a.UpdatedAt = time.Now().In(loc)
+	return
+}
+
+func (ApiKey) TableName() string {
+	return "api_keys"
+}
+
+func (a *ApiKey) GetApplications() []string {
+	return splitList(a.Applications)
+}
+
+func (a *ApiKey) GetAllowedCreatedBy() []string {
+	return splitList(a.AllowedCreatedBy)
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
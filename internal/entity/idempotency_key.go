@@ -0,0 +1,52 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// IdempotencyKey remembers which notifications a producer created for a key,
+// so a retried request returns the original result instead of a duplicate.
+type IdempotencyKey struct {
+	gorm.Model      `json:"-"`
+	ID              uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	Key             string    `json:"key" gorm:"column:idempotency_key;type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_scope"`
+	Application     string    `json:"application" gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_scope"`
+	CreatedBy       uuid.UUID `json:"created_by" gorm:"type:uuid;not null;uniqueIndex:idx_idempotency_keys_scope"`
+	NotificationIDs string    `json:"notification_ids" gorm:"type:text;not null"`
+	ExpiresAt       time.Time `json:"expires_at" gorm:"type:timestamp;not null;index"`
+}
+
+func (i *IdempotencyKey) BeforeCreate(tx *gorm.DB) (err error) {
+	i.ID = uuid.New()
+	loc := time.FixedZone("Asia/Jakarta", 7*60*60)
+	i.CreatedAt = time.Now().In(loc)
+	i.UpdatedAt = time.Now().In(loc)
+	return
+}
+
+func (i *IdempotencyKey) BeforeUpdate(tx *gorm.DB) (err error) {
+	loc := time.FixedZone("Asia/Jakarta", 7*60*60)
+	i.UpdatedAt = time.Now().In(loc)
+	return
+}
+
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+func (i *IdempotencyKey) GetNotificationIDs() []uuid.UUID {
+	var ids []uuid.UUID
+	for _, id := range splitList(i.NotificationIDs) {
+		if parsed, err := uuid.Parse(id); err == nil {
+			ids = append(ids, parsed)
+		}
+	}
+	return ids
+}
+
+func (i *IdempotencyKey) IsExpired() bool {
+	return time.Now().After(i.ExpiresAt)
+}
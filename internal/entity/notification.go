@@ -8,16 +8,20 @@ import (
 )
 
 type Notification struct {
-	gorm.Model  `json:"-"`
-	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
-	Application string     `json:"application" gorm:"type:varchar(255);not null"`
-	Name        string     `json:"name" gorm:"type:varchar(255);not null"`
-	URL         string     `json:"url" gorm:"type:text;not null"`
-	ReadAt      *time.Time `json:"read_at" gorm:"type:timestamp"`
-	Message     string     `json:"message" gorm:"type:text;not null"`
-	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
-	CreatedBy   uuid.UUID  `json:"created_by" gorm:"type:uuid;not null"`
-	UnreadCount int64      `json:"unread_count" gorm:"-:all"`
+	gorm.Model    `json:"-"`
+	ID            uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	Application   string     `json:"application" gorm:"type:varchar(255);not null"`
+	Name          string     `json:"name" gorm:"type:varchar(255);not null"`
+	URL           string     `json:"url" gorm:"type:text;not null"`
+	ReadAt        *time.Time `json:"read_at" gorm:"type:timestamp"`
+	Message       string     `json:"message" gorm:"type:text;not null"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	CreatedBy     uuid.UUID  `json:"created_by" gorm:"type:uuid;not null"`
+	UserName      string     `json:"user_name" gorm:"type:varchar(255);not null;default:''"`       // recipient name at creation time
+	CreatedByName string     `json:"created_by_name" gorm:"type:varchar(255);not null;default:''"` // sender name at creation time
+	SourceType    string     `json:"source_type" gorm:"type:varchar(100);not null;default:'';index:idx_notifications_source"`
+	SourceID      string     `json:"source_id" gorm:"type:varchar(255);not null;default:'';index:idx_notifications_source"`
+	UnreadCount   int64      `json:"unread_count" gorm:"-:all"`
 }
 
 func (n *Notification) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/IlhamSetiaji/julong-notification-be/validator"
+	"github.com/gin-gonic/gin"
+)
+
+type IApiKeyHandler interface {
+	CreateApiKey(ctx *gin.Context)
+	GetAllApiKeys(ctx *gin.Context)
+	RevokeApiKey(ctx *gin.Context)
+}
+
+type ApiKeyHandler struct {
+	logger        logger.Logger
+	validator     validator.Validator
+	apiKeyUseCase usecase.IApiKeyUseCase
+}
+
+func NewApiKeyHandler(
+	logger logger.Logger,
+	validator validator.Validator,
+	apiKeyUseCase usecase.IApiKeyUseCase) IApiKeyHandler {
+	return &ApiKeyHandler{
+		logger:        logger,
+		validator:     validator,
+		apiKeyUseCase: apiKeyUseCase,
+	}
+}
+
+func (h *ApiKeyHandler) CreateApiKey(ctx *gin.Context) {
+	var req request.CreateApiKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		h.logger.GetLogger().Error("Failed to bind JSON: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "Failed to bind JSON", err.Error())
+		return
+	}
+
+	if err := h.validator.GetValidator().Struct(req); err != nil {
+		h.logger.GetLogger().Error("Validation error: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+
+	res, err := h.apiKeyUseCase.CreateApiKey(&req)
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to create api key: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to create API key", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(ctx, http.StatusOK, "API key created successfully", res)
+}
+
+func (h *ApiKeyHandler) GetAllApiKeys(ctx *gin.Context) {
+	apiKeys, err := h.apiKeyUseCase.GetAllApiKeys()
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to get all api keys: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to get API keys", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(ctx, http.StatusOK, "API keys retrieved successfully", apiKeys)
+}
+
+func (h *ApiKeyHandler) RevokeApiKey(ctx *gin.Context) {
+	id := ctx.Param("id")
+	err := h.apiKeyUseCase.RevokeApiKey(id)
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to revoke api key: ", "error", err)
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to revoke API key", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(ctx, http.StatusOK, "API key revoked successfully", nil)
+}
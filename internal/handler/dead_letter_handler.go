@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/rabbitmq"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type IDeadLetterHandler interface {
+	GetDeadLetters(ctx *gin.Context)
+	ReplayDeadLetters(ctx *gin.Context)
+}
+
+type DeadLetterHandler struct {
+	logger     logger.Logger
+	deadLetter *rabbitmq.DeadLetterQueue
+}
+
+func NewDeadLetterHandler(logger logger.Logger, deadLetter *rabbitmq.DeadLetterQueue) IDeadLetterHandler {
+	return &DeadLetterHandler{
+		logger:     logger,
+		deadLetter: deadLetter,
+	}
+}
+
+func (h *DeadLetterHandler) GetDeadLetters(ctx *gin.Context) {
+	messages, err := h.deadLetter.Inspect(parseLimit(ctx))
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to inspect dead letters: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to get dead letters", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(ctx, http.StatusOK, "Dead letters retrieved successfully", messages)
+}
+
+func (h *DeadLetterHandler) ReplayDeadLetters(ctx *gin.Context) {
+	replayed, err := h.deadLetter.Replay(parseLimit(ctx))
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to replay dead letters: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to replay dead letters", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(ctx, http.StatusOK, "Dead letters replayed successfully", gin.H{
+		"replayed": replayed,
+	})
+}
+
+func parseLimit(ctx *gin.Context) int {
+	limit, err := strconv.Atoi(ctx.Query("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	return limit
+}
@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/middleware"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
 	"github.com/IlhamSetiaji/julong-notification-be/logger"
@@ -21,6 +25,9 @@ type INotificationHandler interface {
 	UpdateNotification(ctx *gin.Context)
 	DeleteNotification(ctx *gin.Context)
 	GetUnreadNotificationCount(ctx *gin.Context)
+	MarkNotificationsReadBySource(ctx *gin.Context)
+	MarkNotifications(ctx *gin.Context)
+	DeleteNotificationsBySource(ctx *gin.Context)
 }
 
 type NotificationHandler struct {
@@ -41,6 +48,11 @@ func NewNotificationHandler(
 }
 
 func (h *NotificationHandler) CreateNotification(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
 	var req request.CreateNotificationRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		h.logger.GetLogger().Error("Failed to bind JSON: ", "error", err)
@@ -48,26 +60,41 @@ func (h *NotificationHandler) CreateNotification(ctx *gin.Context) {
 		return
 	}
 
+	if key := ctx.GetHeader("Idempotency-Key"); key != "" {
+		if req.IdempotencyKey != "" && req.IdempotencyKey != key {
+			utils.ErrorResponse(ctx, http.StatusBadRequest, "Validation error", "Idempotency-Key header does not match idempotency_key")
+			return
+		}
+		req.IdempotencyKey = key
+	}
+
 	if err := h.validator.GetValidator().Struct(req); err != nil {
 		h.logger.GetLogger().Error("Validation error: ", "error", err)
 		utils.ErrorResponse(ctx, http.StatusBadRequest, "Validation error", err.Error())
 		return
 	}
 
-	err := h.notificationUseCase.CreateNotification(&req)
+	res, err := h.notificationUseCase.CreateNotification(ctx.Request.Context(), principal, &req)
 	if err != nil {
 		h.logger.GetLogger().Error("Failed to create notification: ", "error", err)
-		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to create notification", err.Error())
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to create notification", err.Error())
 		return
 	}
 
-	utils.SuccessResponse(ctx, http.StatusOK, "Notification created successfully", nil)
+	utils.SuccessResponse(ctx, http.StatusOK, "Notification created successfully", res)
 }
 
 func (h *NotificationHandler) GetNotificationsByKeys(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
 	application := ctx.Query("application")
 	userID := ctx.Query("user_id")
 	readAt := ctx.Query("read_at")
+	sourceType := ctx.Query("source_type")
+	sourceID := ctx.Query("source_id")
 
 	keys := make(map[string]interface{})
 	if application != "" {
@@ -83,6 +110,12 @@ func (h *NotificationHandler) GetNotificationsByKeys(ctx *gin.Context) {
 			keys["read_at"] = "NO"
 		}
 	}
+	if sourceType != "" {
+		keys["source_type"] = sourceType
+	}
+	if sourceID != "" {
+		keys["source_id"] = sourceID
+	}
 
 	page, err := strconv.Atoi(ctx.Query("page"))
 	if err != nil || page < 1 {
@@ -99,19 +132,23 @@ func (h *NotificationHandler) GetNotificationsByKeys(ctx *gin.Context) {
 		search = ""
 	}
 
-	createdAt := ctx.Query("created_at")
+	createdAt := strings.ToUpper(ctx.Query("created_at"))
 	if createdAt == "" {
 		createdAt = "DESC"
 	}
+	if createdAt != "ASC" && createdAt != "DESC" {
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "Validation error", "created_at must be ASC or DESC")
+		return
+	}
 
 	sort := map[string]interface{}{
 		"created_at": createdAt,
 	}
 
-	notifications, total, err := h.notificationUseCase.GetNotificationsByKeys(keys, page, pageSize, search, sort)
+	notifications, total, err := h.notificationUseCase.GetNotificationsByKeys(ctx.Request.Context(), principal, keys, page, pageSize, search, sort)
 	if err != nil {
 		h.logger.GetLogger().Error("Failed to get notifications by keys: ", "error", err)
-		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to get notifications", err.Error())
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to get notifications", err.Error())
 		return
 	}
 
@@ -122,10 +159,15 @@ func (h *NotificationHandler) GetNotificationsByKeys(ctx *gin.Context) {
 }
 
 func (h *NotificationHandler) GetAllNotifications(ctx *gin.Context) {
-	notifications, err := h.notificationUseCase.GetAllNotifications()
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
+	notifications, err := h.notificationUseCase.GetAllNotifications(ctx.Request.Context(), principal)
 	if err != nil {
 		h.logger.GetLogger().Error("Failed to get all notifications: ", "error", err)
-		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to get notifications", err.Error())
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to get notifications", err.Error())
 		return
 	}
 
@@ -133,16 +175,16 @@ func (h *NotificationHandler) GetAllNotifications(ctx *gin.Context) {
 }
 
 func (h *NotificationHandler) FindByID(ctx *gin.Context) {
-	id := ctx.Param("id")
-	notification, err := h.notificationUseCase.FindByID(id)
-	if err != nil {
-		h.logger.GetLogger().Error("Failed to find notification by ID: ", "error", err)
-		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to find notification", err.Error())
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
 		return
 	}
 
-	if notification == nil {
-		utils.ErrorResponse(ctx, http.StatusNotFound, "Notification not found", "Notification not found")
+	id := ctx.Param("id")
+	notification, err := h.notificationUseCase.FindByID(ctx.Request.Context(), principal, id)
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to find notification by ID: ", "error", err)
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to find notification", err.Error())
 		return
 	}
 
@@ -150,11 +192,16 @@ func (h *NotificationHandler) FindByID(ctx *gin.Context) {
 }
 
 func (h *NotificationHandler) GetByUserID(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
 	userID := ctx.Param("user_id")
-	notifications, err := h.notificationUseCase.GetByUserID(userID)
+	notifications, err := h.notificationUseCase.GetByUserID(ctx.Request.Context(), principal, userID)
 	if err != nil {
 		h.logger.GetLogger().Error("Failed to get notifications by user ID: ", "error", err)
-		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to get notifications", err.Error())
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to get notifications", err.Error())
 		return
 	}
 
@@ -162,6 +209,11 @@ func (h *NotificationHandler) GetByUserID(ctx *gin.Context) {
 }
 
 func (h *NotificationHandler) UpdateNotification(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
 	var req request.UpdateNotificationRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		h.logger.GetLogger().Error("Failed to bind JSON: ", "error", err)
@@ -175,10 +227,10 @@ func (h *NotificationHandler) UpdateNotification(ctx *gin.Context) {
 		return
 	}
 
-	res, err := h.notificationUseCase.UpdateNotification(&req)
+	res, err := h.notificationUseCase.UpdateNotification(ctx.Request.Context(), principal, &req)
 	if err != nil {
 		h.logger.GetLogger().Error("Failed to update notification: ", "error", err)
-		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to update notification", err.Error())
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to update notification", err.Error())
 		return
 	}
 
@@ -186,11 +238,16 @@ func (h *NotificationHandler) UpdateNotification(ctx *gin.Context) {
 }
 
 func (h *NotificationHandler) DeleteNotification(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
 	id := ctx.Param("id")
-	err := h.notificationUseCase.DeleteNotification(id)
+	err := h.notificationUseCase.DeleteNotification(ctx.Request.Context(), principal, id)
 	if err != nil {
 		h.logger.GetLogger().Error("Failed to delete notification: ", "error", err)
-		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to delete notification", err.Error())
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to delete notification", err.Error())
 		return
 	}
 
@@ -198,21 +255,146 @@ func (h *NotificationHandler) DeleteNotification(ctx *gin.Context) {
 }
 
 func (h *NotificationHandler) GetUnreadNotificationCount(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
 	userID := ctx.Query("user_id")
-	application := ctx.Query("application")
+	if userID == "" {
+		userID = principal.UserID.String()
+	}
 
-	if userID == "" || application == "" {
-		h.logger.GetLogger().Error("User ID or application is missing")
-		utils.ErrorResponse(ctx, http.StatusBadRequest, "User ID or application is missing", "User ID or application is missing")
+	application := ctx.Query("application")
+	if application == "" {
+		h.logger.GetLogger().Error("Application is missing")
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "Application is missing", "Application is missing")
 		return
 	}
 
-	count, err := h.notificationUseCase.GetUnreadNotificationCount(userID, application)
+	count, err := h.notificationUseCase.GetUnreadNotificationCount(ctx.Request.Context(), principal, userID, application)
 	if err != nil {
 		h.logger.GetLogger().Error("Failed to get unread notification count: ", "error", err)
-		utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to get unread notification count", err.Error())
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to get unread notification count", err.Error())
 		return
 	}
 
 	utils.SuccessResponse(ctx, http.StatusOK, "Unread notification count retrieved successfully", count)
 }
+
+func (h *NotificationHandler) MarkNotifications(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
+	var req request.MarkNotificationsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		h.logger.GetLogger().Error("Failed to bind JSON: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "Failed to bind JSON", err.Error())
+		return
+	}
+
+	if err := h.validator.GetValidator().Struct(req); err != nil {
+		h.logger.GetLogger().Error("Validation error: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+
+	updated, err := h.notificationUseCase.MarkNotifications(ctx.Request.Context(), principal, &req)
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to mark notifications: ", "error", err)
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to mark notifications", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(ctx, http.StatusOK, "Notifications marked successfully", gin.H{
+		"updated": updated,
+	})
+}
+
+func (h *NotificationHandler) MarkNotificationsReadBySource(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
+	req, ok := h.bindNotificationSourceRequest(ctx)
+	if !ok {
+		return
+	}
+
+	updated, err := h.notificationUseCase.MarkNotificationsReadBySource(ctx.Request.Context(), principal, req)
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to mark notifications read by source: ", "error", err)
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to mark notifications as read", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(ctx, http.StatusOK, "Notifications marked as read successfully", gin.H{
+		"updated": updated,
+	})
+}
+
+func (h *NotificationHandler) DeleteNotificationsBySource(ctx *gin.Context) {
+	principal, ok := h.getPrincipal(ctx)
+	if !ok {
+		return
+	}
+
+	req, ok := h.bindNotificationSourceRequest(ctx)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.notificationUseCase.DeleteNotificationsBySource(ctx.Request.Context(), principal, req)
+	if err != nil {
+		h.logger.GetLogger().Error("Failed to delete notifications by source: ", "error", err)
+		utils.ErrorResponse(ctx, errorStatusCode(err), "Failed to delete notifications", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(ctx, http.StatusOK, "Notifications deleted successfully", gin.H{
+		"deleted": deleted,
+	})
+}
+
+func (h *NotificationHandler) bindNotificationSourceRequest(ctx *gin.Context) (*request.NotificationSourceRequest, bool) {
+	var req request.NotificationSourceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		h.logger.GetLogger().Error("Failed to bind JSON: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "Failed to bind JSON", err.Error())
+		return nil, false
+	}
+
+	if err := h.validator.GetValidator().Struct(req); err != nil {
+		h.logger.GetLogger().Error("Validation error: ", "error", err)
+		utils.ErrorResponse(ctx, http.StatusBadRequest, "Validation error", err.Error())
+		return nil, false
+	}
+
+	return &req, true
+}
+
+func (h *NotificationHandler) getPrincipal(ctx *gin.Context) (*auth.Principal, bool) {
+	principal, ok := middleware.GetPrincipal(ctx)
+	if !ok {
+		h.logger.GetLogger().Error("Authenticated principal is missing from context")
+		utils.ErrorResponse(ctx, http.StatusUnauthorized, "Unauthorized", "Unauthorized")
+		return nil, false
+	}
+	return principal, true
+}
+
+func errorStatusCode(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, auth.ErrNotFound), errors.Is(err, usecase.ErrApiKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, usecase.ErrValidation):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
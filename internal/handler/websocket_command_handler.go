@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/websocket"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/validator"
+)
+
+// WebSocketCommandHandler runs socket commands as the user who opened the
+// connection, through the same use case as the REST endpoints.
+type WebSocketCommandHandler struct {
+	log                 logger.Logger
+	validator           validator.Validator
+	notificationUseCase usecase.INotificationUseCase
+	principal           *auth.Principal
+}
+
+func NewWebSocketCommandHandler(
+	log logger.Logger,
+	validator validator.Validator,
+	notificationUseCase usecase.INotificationUseCase,
+	principal *auth.Principal) websocket.CommandHandler {
+	return &WebSocketCommandHandler{
+		log:                 log,
+		validator:           validator,
+		notificationUseCase: notificationUseCase,
+		principal:           principal,
+	}
+}
+
+func (h *WebSocketCommandHandler) HandleCommand(client *websocket.Client, cmd websocket.Command) (interface{}, error) {
+	switch cmd.Type {
+	case websocket.CommandMarkRead:
+		var req request.MarkNotificationReadRequest
+		if err := h.decode(cmd, &req); err != nil {
+			return nil, err
+		}
+		return h.notificationUseCase.MarkNotificationRead(client.Context(), h.principal, req.ID)
+	case websocket.CommandMarkAllRead:
+		var req request.MarkNotificationsRequest
+		if err := h.decode(cmd, &req); err != nil {
+			return nil, err
+		}
+		// the use case limits this to the socket owner's own notifications
+		req.IDs = nil
+		req.Unread = false
+
+		updated, err := h.notificationUseCase.MarkNotifications(client.Context(), h.principal, &req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"updated": updated}, nil
+	case websocket.CommandSubscribe, websocket.CommandUnsubscribe:
+		var req request.SubscriptionRequest
+		if err := h.decode(cmd, &req); err != nil {
+			return nil, err
+		}
+		if cmd.Type == websocket.CommandSubscribe {
+			client.Subscribe(req.Application)
+		} else if err := client.Unsubscribe(req.Application); err != nil {
+			return nil, err
+		}
+		return h.subscriptions(client)
+	case websocket.CommandSetSubscriptions:
+		var req request.SetSubscriptionsRequest
+		if err := h.decode(cmd, &req); err != nil {
+			return nil, err
+		}
+		client.SetSubscriptions(req.Applications)
+		return h.subscriptions(client)
+	default:
+		return nil, websocket.ErrUnknownCommand
+	}
+}
+
+// subscriptions replies with the applications the client now receives and
+// their unread counts, so the frontend can refresh every badge at once. all
+// is set while the client receives every application.
+func (h *WebSocketCommandHandler) subscriptions(client *websocket.Client) (interface{}, error) {
+	all := client.SubscribedToAll()
+	applications := client.Subscriptions()
+	counts := map[string]int64{}
+	if all || len(applications) > 0 {
+		var err error
+		counts, err = h.notificationUseCase.GetUnreadCountsByApplication(client.Context(), h.principal, client.UserID.String(), applications)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{
+		"all":           all,
+		"applications":  applications,
+		"unread_counts": counts,
+	}, nil
+}
+
+func (h *WebSocketCommandHandler) decode(cmd websocket.Command, req interface{}) error {
+	if len(cmd.Data) > 0 {
+		if err := json.Unmarshal(cmd.Data, req); err != nil {
+			h.log.GetLogger().Error("Failed to decode websocket command: ", "error", err)
+			return err
+		}
+	}
+	return h.validator.GetValidator().Struct(req)
+}
@@ -2,13 +2,19 @@
 package handler
 
 import (
+	"context"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/IlhamSetiaji/julong-notification-be/internal/middleware"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/websocket"
 	"github.com/IlhamSetiaji/julong-notification-be/logger"
 	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/IlhamSetiaji/julong-notification-be/validator"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type IWebSocketHandler interface {
@@ -16,31 +22,101 @@ type IWebSocketHandler interface {
 }
 
 type WebSocketHandler struct {
-	log logger.Logger
-	hub *websocket.Hub
+	log                 logger.Logger
+	validator           validator.Validator
+	hub                 *websocket.Hub
+	notificationUseCase usecase.INotificationUseCase
 }
 
-func NewWebSocketHandler(log logger.Logger, hub *websocket.Hub) IWebSocketHandler {
+func NewWebSocketHandler(
+	log logger.Logger,
+	validator validator.Validator,
+	hub *websocket.Hub,
+	notificationUseCase usecase.INotificationUseCase) IWebSocketHandler {
 	return &WebSocketHandler{
-		log: log,
-		hub: hub,
+		log:                 log,
+		validator:           validator,
+		hub:                 hub,
+		notificationUseCase: notificationUseCase,
 	}
 }
 
 func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
-	userIDStr := c.Query("user_id")
-	appType := c.Query("app_type")
-
-	if userIDStr == "" {
-		utils.ErrorResponse(c, http.StatusBadRequest, "User ID is required", "User ID is required")
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		utils.ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "Unauthorized")
 		return
 	}
 
-	userID, err := uuid.Parse(userIDStr)
-	if err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid user ID format", "Invalid user ID format")
+	// app_type may be repeated or comma separated, none subscribes to everything
+	subscriptions := &request.SetSubscriptionsRequest{
+		Applications: parseApplications(c.QueryArray("app_type")),
+	}
+	if err := h.validator.GetValidator().Struct(subscriptions); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Validation error", err.Error())
 		return
 	}
 
-	websocket.ServeWS(h.hub, c.Writer, c.Request, userID, appType)
+	// format=legacy keeps the bare notification frames for old clients
+	opts := websocket.ClientOptions{
+		Applications: subscriptions.Applications,
+		Legacy:       c.Query("format") == "legacy",
+		Commands:     NewWebSocketCommandHandler(h.log, h.validator, h.notificationUseCase, principal),
+		UnreadCounts: func(ctx context.Context, applications []string) (map[string]int64, error) {
+			return h.notificationUseCase.GetUnreadCountsByApplication(ctx, principal, principal.UserID.String(), applications)
+		},
+	}
+
+	if overflow := c.Query("overflow"); overflow != "" {
+		policy, ok := websocket.ParseOverflowPolicy(overflow)
+		if !ok {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Validation error", "overflow must be disconnect, drop_oldest or coalesce")
+			return
+		}
+		opts.Policy = policy
+	}
+
+	// since or last_event_id resume a dropped connection; resume=ack resumes
+	// from the last event the user acknowledged on this instance
+	replayReq := &request.ReplayNotificationsRequest{
+		UserID:       principal.UserID.String(),
+		Applications: opts.Applications,
+		Since:        c.Query("since"),
+		LastEventID:  c.Query("last_event_id"),
+	}
+	if replayReq.LastEventID == "" && c.Query("resume") == "ack" {
+		replayReq.LastEventID = h.hub.LastAck(principal.UserID)
+	}
+	if replayReq.Since != "" || replayReq.LastEventID != "" {
+		if err := h.validator.GetValidator().Struct(replayReq); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Validation error", err.Error())
+			return
+		}
+		if replayReq.Since != "" {
+			if _, err := time.Parse(time.RFC3339, replayReq.Since); err != nil {
+				utils.ErrorResponse(c, http.StatusBadRequest, "Validation error", "since must be RFC3339")
+				return
+			}
+		}
+		opts.Replay = func(ctx context.Context) ([]websocket.WsNotification, bool, error) {
+			return h.notificationUseCase.ReplayNotifications(ctx, principal, replayReq)
+		}
+	}
+
+	websocket.ServeWS(h.hub, c.Writer, c.Request, principal.UserID, opts)
+}
+
+func parseApplications(values []string) []string {
+	seen := make(map[string]bool)
+	var applications []string
+	for _, value := range values {
+		for _, application := range strings.Split(value, ",") {
+			application = strings.TrimSpace(application)
+			if application != "" && !seen[application] {
+				seen[application] = true
+				applications = append(applications, application)
+			}
+		}
+	}
+	return applications
 }
@@ -0,0 +1,163 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/google/uuid"
+)
+
+const defaultRPCTimeout = 10 * time.Second
+
+// RemoteError is an error reported by the remote service in its reply, as
+// opposed to a transport failure or a timeout.
+type RemoteError struct {
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+var (
+	rpcClientInstance *RPCClient
+	rpcOnce           sync.Once
+)
+
+// RPCClient correlates request messages published to other services with the
+// replies the consumer receives on our own queue.
+type RPCClient struct {
+	replyTo string
+	timeout time.Duration
+	pending map[string]chan response.RabbitMQResponse
+	mu      sync.Mutex
+}
+
+func NewRPCClient(replyTo string, timeout time.Duration) *RPCClient {
+	if timeout <= 0 {
+		timeout = defaultRPCTimeout
+	}
+	return &RPCClient{
+		replyTo: replyTo,
+		timeout: timeout,
+		pending: make(map[string]chan response.RabbitMQResponse),
+	}
+}
+
+func GetRPCClient() *RPCClient {
+	rpcOnce.Do(func() {
+		conf := config.GetConfig()
+		rpcClientInstance = NewRPCClient(conf.RabbitMq.Queue, time.Duration(conf.RabbitMq.RpcTimeout)*time.Second)
+	})
+	return rpcClientInstance
+}
+
+// Timeout is the default deadline for calls made without one.
+func (c *RPCClient) Timeout() time.Duration {
+	return c.timeout
+}
+
+// Send publishes a request and blocks until its reply arrives or ctx is done.
+func (c *RPCClient) Send(ctx context.Context, queueName string, messageType string, payload map[string]interface{}) (response.RabbitMQResponse, error) {
+	docMsg := request.RabbitMQRequest{
+		ID:          uuid.New().String(),
+		MessageType: messageType,
+		MessageData: payload,
+		ReplyTo:     c.replyTo,
+	}
+
+	rchan := make(chan response.RabbitMQResponse, 1)
+	c.mu.Lock()
+	c.pending[docMsg.ID] = rchan
+	c.mu.Unlock()
+	defer c.forget(docMsg.ID)
+
+	log.Printf("INFO: document message: %v", docMsg)
+
+	result := make(chan error, 1)
+	msg := utils.RabbitMsgPublisher{
+		QueueName: queueName,
+		Message:   docMsg,
+		Result:    result,
+	}
+	select {
+	case utils.Pchan <- msg:
+	case <-ctx.Done():
+		log.Printf("ERROR: request not published uid: %s: %v", docMsg.ID, ctx.Err())
+		return response.RabbitMQResponse{}, ctx.Err()
+	}
+
+	for {
+		select {
+		case err := <-result:
+			if err != nil {
+				// nobody will reply to a request the broker did not accept
+				log.Printf("ERROR: request not delivered uid: %s: %v", docMsg.ID, err)
+				return response.RabbitMQResponse{}, err
+			}
+			result = nil
+		case docReply := <-rchan:
+			log.Printf("INFO: received reply: %v uid: %s", docReply, docMsg.ID)
+			return docReply, nil
+		case <-ctx.Done():
+			log.Printf("ERROR: request timeout uid: %s", docMsg.ID)
+			return response.RabbitMQResponse{}, ctx.Err()
+		}
+	}
+}
+
+// Deliver hands a reply to the caller waiting on its ID. It reports false
+// when nobody is waiting, e.g. because the call already timed out.
+func (c *RPCClient) Deliver(docReply response.RabbitMQResponse) bool {
+	c.mu.Lock()
+	rchan, ok := c.pending[docReply.ID]
+	if ok {
+		delete(c.pending, docReply.ID)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	rchan <- docReply
+	return true
+}
+
+func (c *RPCClient) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// Call sends a request and decodes the reply's message_data into T. A
+// non-empty "error" field in the reply is returned as an error.
+func Call[T any](ctx context.Context, c *RPCClient, queueName string, messageType string, payload map[string]interface{}) (*T, error) {
+	resp, err := c.Send(ctx, queueName, messageType, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if errMsg, ok := resp.MessageData["error"].(string); ok && errMsg != "" {
+		return nil, &RemoteError{Message: errMsg}
+	}
+
+	raw, err := json.Marshal(resp.MessageData)
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(T)
+	if err := json.Unmarshal(raw, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+)
+
+// fakeBroker takes the next published request off Pchan, confirms it with
+// publishErr and, when reply is set, answers it through Deliver.
+func fakeBroker(t *testing.T, client *RPCClient, publishErr error, reply map[string]interface{}) <-chan utils.RabbitMsgPublisher {
+	t.Helper()
+	published := make(chan utils.RabbitMsgPublisher, 1)
+	go func() {
+		msg := <-utils.Pchan
+		published <- msg
+		msg.Result <- publishErr
+		if publishErr == nil && reply != nil {
+			client.Deliver(response.RabbitMQResponse{
+				ID:          msg.Message.ID,
+				MessageType: "reply",
+				MessageData: reply,
+			})
+		}
+	}()
+	return published
+}
+
+func TestRPCClientSendCorrelatesReply(t *testing.T) {
+	client := NewRPCClient("notification", time.Second)
+	published := fakeBroker(t, client, nil, map[string]interface{}{"name": "Jane"})
+
+	reply, err := client.Send(context.Background(), "julong_sso", "find_user_by_id", map[string]interface{}{"user_id": "1"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg := <-published
+	if msg.QueueName != "julong_sso" || msg.Message.ReplyTo != "notification" || msg.Message.MessageType != "find_user_by_id" {
+		t.Fatalf("published %+v", msg)
+	}
+	if reply.ID != msg.Message.ID || reply.MessageData["name"] != "Jane" {
+		t.Fatalf("reply = %+v", reply)
+	}
+	if len(client.pending) != 0 {
+		t.Fatalf("%d calls still pending", len(client.pending))
+	}
+}
+
+func TestRPCClientSendCancelled(t *testing.T) {
+	client := NewRPCClient("notification", time.Second)
+	published := fakeBroker(t, client, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := client.Send(ctx, "julong_sso", "find_user_by_id", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Send() = %v, want deadline exceeded", err)
+	}
+
+	// a late reply finds nobody waiting
+	msg := <-published
+	if client.Deliver(response.RabbitMQResponse{ID: msg.Message.ID}) {
+		t.Fatal("late reply was delivered")
+	}
+}
+
+func TestRPCClientSendNotPublished(t *testing.T) {
+	client := NewRPCClient("notification", time.Second)
+	fakeBroker(t, client, errors.New("nacked"), nil)
+
+	if _, err := client.Send(context.Background(), "julong_sso", "find_user_by_id", nil); err == nil || err.Error() != "nacked" {
+		t.Fatalf("Send() = %v, want the publish error", err)
+	}
+	if len(client.pending) != 0 {
+		t.Fatalf("%d calls still pending", len(client.pending))
+	}
+}
+
+func TestRPCClientDeliverUnknownID(t *testing.T) {
+	client := NewRPCClient("notification", time.Second)
+	if client.Deliver(response.RabbitMQResponse{ID: "unknown"}) {
+		t.Fatal("reply without a caller was delivered")
+	}
+}
+
+func TestCallDecodesReply(t *testing.T) {
+	client := NewRPCClient("notification", time.Second)
+	fakeBroker(t, client, nil, map[string]interface{}{"user_id": "1", "name": "Jane"})
+
+	reply, err := Call[findUserByIDReply](context.Background(), client, "julong_sso", "find_user_by_id", nil)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if reply.UserID != "1" || reply.Name != "Jane" {
+		t.Fatalf("reply = %+v", reply)
+	}
+}
+
+func TestCallReturnsRemoteError(t *testing.T) {
+	client := NewRPCClient("notification", time.Second)
+	fakeBroker(t, client, nil, map[string]interface{}{"error": "user not found"})
+
+	_, err := Call[findUserByIDReply](context.Background(), client, "julong_sso", "find_user_by_id", nil)
+	var remoteErr *RemoteError
+	if !errors.As(err, &remoteErr) || remoteErr.Message != "user not found" {
+		t.Fatalf("Call() = %v, want a RemoteError", err)
+	}
+}
+
+func TestUserMessageHonoursCallerContext(t *testing.T) {
+	client := NewRPCClient("notification", time.Minute)
+	fakeBroker(t, client, nil, nil)
+	userMessage := &UserMessage{RPCClient: client}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := userMessage.SendFindUsersByIDsMessage(ctx, requestIDs("1")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("SendFindUsersByIDsMessage() = %v, want canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("call outlived its context by %s", elapsed)
+	}
+}
+
+func requestIDs(ids ...string) request.SendFindUsersByIDsMessageRequest {
+	return request.SendFindUsersByIDsMessageRequest{IDs: ids}
+}
@@ -0,0 +1,194 @@
+package messaging
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+)
+
+const (
+	defaultUserCacheSize        = 1000
+	defaultUserCacheTTL         = 5 * time.Minute
+	defaultUserCacheNegativeTTL = 30 * time.Second
+)
+
+type IUserCache interface {
+	Invalidate(userID string)
+}
+
+// CachedUserMessage is an LRU cache with per-entry TTL in front of
+// IUserMessage. Users the SSO reports as missing are cached for the shorter
+// negative TTL; transport errors such as timeouts are never cached.
+type CachedUserMessage struct {
+	Log         logger.Logger
+	UserMessage IUserMessage
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	entries     map[string]*list.Element
+	order       *list.List // front is most recently used
+	mu          sync.Mutex
+}
+
+type userCacheEntry struct {
+	userID    string
+	user      *response.SendFindUserByIDResponse
+	err       error
+	expiresAt time.Time
+}
+
+func NewCachedUserMessage(log logger.Logger, conf config.Config, userMessage IUserMessage) *CachedUserMessage {
+	size := defaultUserCacheSize
+	ttl := defaultUserCacheTTL
+	negativeTTL := defaultUserCacheNegativeTTL
+	if conf.UserCache != nil {
+		if conf.UserCache.Size > 0 {
+			size = conf.UserCache.Size
+		}
+		if conf.UserCache.Ttl > 0 {
+			ttl = time.Duration(conf.UserCache.Ttl) * time.Second
+		}
+		if conf.UserCache.NegativeTtl > 0 {
+			negativeTTL = time.Duration(conf.UserCache.NegativeTtl) * time.Second
+		}
+	}
+
+	return &CachedUserMessage{
+		Log:         log,
+		UserMessage: userMessage,
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+func (c *CachedUserMessage) SendFindUserByIDMessage(ctx context.Context, req request.SendFindUserByIDMessageRequest) (*response.SendFindUserByIDResponse, error) {
+	if entry, ok := c.get(req.ID); ok {
+		return entry.user, entry.err
+	}
+
+	user, err := c.UserMessage.SendFindUserByIDMessage(ctx, req)
+	if err != nil {
+		var remoteErr *RemoteError
+		if errors.As(err, &remoteErr) {
+			c.set(req.ID, nil, err, c.negativeTTL)
+		}
+		return nil, err
+	}
+
+	c.set(req.ID, user, nil, c.ttl)
+	return user, nil
+}
+
+// SendFindUsersByIDsMessage answers from the cache where possible and
+// resolves all misses with a single batch request. Users missing from the SSO
+// reply are negatively cached. When the batch request fails, the cached users
+// are still returned together with the error.
+func (c *CachedUserMessage) SendFindUsersByIDsMessage(ctx context.Context, req request.SendFindUsersByIDsMessageRequest) (*response.SendFindUsersByIDsResponse, error) {
+	result := &response.SendFindUsersByIDsResponse{}
+	var misses []string
+	for _, userID := range req.IDs {
+		entry, ok := c.get(userID)
+		if !ok {
+			misses = append(misses, userID)
+			continue
+		}
+		if entry.user != nil {
+			result.Users = append(result.Users, *entry.user)
+		}
+	}
+
+	if len(misses) == 0 {
+		return result, nil
+	}
+
+	resolved, err := c.UserMessage.SendFindUsersByIDsMessage(ctx, request.SendFindUsersByIDsMessageRequest{
+		IDs: misses,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	found := make(map[string]bool, len(resolved.Users))
+	for _, user := range resolved.Users {
+		user := user
+		found[user.ID] = true
+		c.set(user.ID, &user, nil, c.ttl)
+		result.Users = append(result.Users, user)
+	}
+
+	for _, userID := range misses {
+		if !found[userID] {
+			c.set(userID, nil, &RemoteError{Message: "user not found"}, c.negativeTTL)
+		}
+	}
+
+	return result, nil
+}
+
+func (c *CachedUserMessage) SendGetUserMe(ctx context.Context, req request.SendFindUserByIDMessageRequest) (*response.SendGetUserMeResponse, error) {
+	return c.UserMessage.SendGetUserMe(ctx, req)
+}
+
+func (c *CachedUserMessage) Invalidate(userID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[userID]; ok {
+		c.order.Remove(element)
+		delete(c.entries, userID)
+	}
+}
+
+func (c *CachedUserMessage) get(userID string) (*userCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[userID]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*userCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, userID)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry, true
+}
+
+func (c *CachedUserMessage) set(userID string, user *response.SendFindUserByIDResponse, err error, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &userCacheEntry{
+		userID:    userID,
+		user:      user,
+		err:       err,
+		expiresAt: time.Now().Add(ttl),
+	}
+
+	if element, ok := c.entries[userID]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[userID] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*userCacheEntry).userID)
+	}
+}
@@ -0,0 +1,199 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+)
+
+// fakeUserMessage knows a fixed set of users and records every ID it is
+// asked for.
+type fakeUserMessage struct {
+	users     map[string]string
+	err       error
+	requested []string
+}
+
+func (f *fakeUserMessage) SendFindUserByIDMessage(ctx context.Context, req request.SendFindUserByIDMessageRequest) (*response.SendFindUserByIDResponse, error) {
+	f.requested = append(f.requested, req.ID)
+	if f.err != nil {
+		return nil, f.err
+	}
+	name, ok := f.users[req.ID]
+	if !ok {
+		return nil, &RemoteError{Message: "user not found"}
+	}
+	return &response.SendFindUserByIDResponse{ID: req.ID, Name: name}, nil
+}
+
+func (f *fakeUserMessage) SendFindUsersByIDsMessage(ctx context.Context, req request.SendFindUsersByIDsMessageRequest) (*response.SendFindUsersByIDsResponse, error) {
+	f.requested = append(f.requested, req.IDs...)
+	if f.err != nil {
+		return nil, f.err
+	}
+	res := &response.SendFindUsersByIDsResponse{}
+	for _, id := range req.IDs {
+		if name, ok := f.users[id]; ok {
+			res.Users = append(res.Users, response.SendFindUserByIDResponse{ID: id, Name: name})
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeUserMessage) SendGetUserMe(ctx context.Context, req request.SendFindUserByIDMessageRequest) (*response.SendGetUserMeResponse, error) {
+	return &response.SendGetUserMeResponse{}, nil
+}
+
+func newTestCache(size int, backend *fakeUserMessage) *CachedUserMessage {
+	return NewCachedUserMessage(logger.NewLogger(), config.Config{
+		UserCache: &config.UserCache{Size: size, Ttl: 60, NegativeTtl: 60},
+	}, backend)
+}
+
+func findUser(t *testing.T, cache *CachedUserMessage, id string) (*response.SendFindUserByIDResponse, error) {
+	t.Helper()
+	return cache.SendFindUserByIDMessage(context.Background(), request.SendFindUserByIDMessageRequest{ID: id})
+}
+
+func TestUserCacheHit(t *testing.T) {
+	backend := &fakeUserMessage{users: map[string]string{"1": "Jane"}}
+	cache := newTestCache(10, backend)
+
+	for i := 0; i < 3; i++ {
+		user, err := findUser(t, cache, "1")
+		if err != nil || user.Name != "Jane" {
+			t.Fatalf("find user = %+v, %v", user, err)
+		}
+	}
+	if len(backend.requested) != 1 {
+		t.Fatalf("SSO asked %d times, want 1", len(backend.requested))
+	}
+}
+
+func TestUserCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	backend := &fakeUserMessage{users: map[string]string{"1": "a", "2": "b", "3": "c"}}
+	cache := newTestCache(2, backend)
+
+	findUser(t, cache, "1")
+	findUser(t, cache, "2")
+	findUser(t, cache, "1") // 2 is now the least recently used
+	findUser(t, cache, "3")
+
+	backend.requested = nil
+	findUser(t, cache, "1")
+	findUser(t, cache, "3")
+	if len(backend.requested) != 0 {
+		t.Fatalf("recently used users were evicted: %v", backend.requested)
+	}
+	findUser(t, cache, "2")
+	if len(backend.requested) != 1 || backend.requested[0] != "2" {
+		t.Fatalf("SSO asked for %v, want [2]", backend.requested)
+	}
+}
+
+func TestUserCacheExpires(t *testing.T) {
+	backend := &fakeUserMessage{users: map[string]string{"1": "Jane"}}
+	cache := newTestCache(10, backend)
+	cache.ttl = 10 * time.Millisecond
+
+	findUser(t, cache, "1")
+	time.Sleep(20 * time.Millisecond)
+	findUser(t, cache, "1")
+
+	if len(backend.requested) != 2 {
+		t.Fatalf("SSO asked %d times, want 2 after expiry", len(backend.requested))
+	}
+}
+
+func TestUserCacheNegativeCaching(t *testing.T) {
+	backend := &fakeUserMessage{users: map[string]string{}}
+	cache := newTestCache(10, backend)
+	cache.negativeTTL = 10 * time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		var remoteErr *RemoteError
+		if _, err := findUser(t, cache, "missing"); !errors.As(err, &remoteErr) {
+			t.Fatalf("find user = %v, want a RemoteError", err)
+		}
+	}
+	if len(backend.requested) != 1 {
+		t.Fatalf("SSO asked %d times, want 1 while negatively cached", len(backend.requested))
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	findUser(t, cache, "missing")
+	if len(backend.requested) != 2 {
+		t.Fatalf("negative entry did not expire")
+	}
+}
+
+func TestUserCacheDoesNotCacheTransportErrors(t *testing.T) {
+	backend := &fakeUserMessage{err: context.DeadlineExceeded}
+	cache := newTestCache(10, backend)
+
+	findUser(t, cache, "1")
+	findUser(t, cache, "1")
+	if len(backend.requested) != 2 {
+		t.Fatalf("SSO asked %d times, transport errors must not be cached", len(backend.requested))
+	}
+}
+
+func TestUserCacheBatchLookup(t *testing.T) {
+	backend := &fakeUserMessage{users: map[string]string{"1": "a", "2": "b"}}
+	cache := newTestCache(10, backend)
+	findUser(t, cache, "1")
+
+	backend.requested = nil
+	res, err := cache.SendFindUsersByIDsMessage(context.Background(), requestIDs("1", "2", "3"))
+	if err != nil {
+		t.Fatalf("SendFindUsersByIDsMessage: %v", err)
+	}
+	if len(res.Users) != 2 {
+		t.Fatalf("users = %+v", res.Users)
+	}
+	if len(backend.requested) != 2 {
+		t.Fatalf("SSO asked for %v, want only the misses", backend.requested)
+	}
+
+	// 3 was missing from the reply and is now negatively cached
+	backend.requested = nil
+	cache.SendFindUsersByIDsMessage(context.Background(), requestIDs("1", "2", "3"))
+	if len(backend.requested) != 0 {
+		t.Fatalf("SSO asked for %v, want a full cache hit", backend.requested)
+	}
+}
+
+func TestUserCacheBatchLookupFailureReturnsCachedUsers(t *testing.T) {
+	backend := &fakeUserMessage{users: map[string]string{"1": "a"}}
+	cache := newTestCache(10, backend)
+	findUser(t, cache, "1")
+
+	backend.err = errors.New("sso down")
+	res, err := cache.SendFindUsersByIDsMessage(context.Background(), requestIDs("1", "2"))
+	if err == nil {
+		t.Fatal("expected the lookup error")
+	}
+	if len(res.Users) != 1 || res.Users[0].Name != "a" {
+		t.Fatalf("users = %+v", res.Users)
+	}
+}
+
+func TestUserCacheInvalidate(t *testing.T) {
+	backend := &fakeUserMessage{users: map[string]string{"1": "Jane"}}
+	cache := newTestCache(10, backend)
+
+	findUser(t, cache, "1")
+	cache.Invalidate("1")
+	backend.users["1"] = "Janet"
+
+	user, _ := findUser(t, cache, "1")
+	if user.Name != "Janet" {
+		t.Fatalf("name = %s, want the refreshed name", user.Name)
+	}
+}
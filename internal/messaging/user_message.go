@@ -1,116 +1,115 @@
 package messaging
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"log"
 
 	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
 	"github.com/IlhamSetiaji/julong-notification-be/logger"
-	"github.com/IlhamSetiaji/julong-notification-be/utils"
-	"github.com/google/uuid"
 )
 
+const ssoQueue = "julong_sso"
+
+// IUserMessage calls the SSO over RPC. Every call ends when ctx is done or the
+// RPC client's timeout passes, whichever comes first.
 type IUserMessage interface {
-	SendFindUserByIDMessage(request request.SendFindUserByIDMessageRequest) (*response.SendFindUserByIDResponse, error)
-	SendGetUserMe(request request.SendFindUserByIDMessageRequest) (*response.SendGetUserMeResponse, error)
+	SendFindUserByIDMessage(ctx context.Context, request request.SendFindUserByIDMessageRequest) (*response.SendFindUserByIDResponse, error)
+	SendFindUsersByIDsMessage(ctx context.Context, request request.SendFindUsersByIDsMessageRequest) (*response.SendFindUsersByIDsResponse, error)
+	SendGetUserMe(ctx context.Context, request request.SendFindUserByIDMessageRequest) (*response.SendGetUserMeResponse, error)
 }
 
 type UserMessage struct {
-	Log logger.Logger
+	Log       logger.Logger
+	RPCClient *RPCClient
+}
+
+// findUserByIDReply is the message_data of the SSO reply to find_user_by_id.
+type findUserByIDReply struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
 }
 
-func NewUserMessage(log logger.Logger) IUserMessage {
+// findUsersByIDsReply is the message_data of the SSO reply to find_users_by_ids.
+type findUsersByIDsReply struct {
+	Users []findUserByIDReply `json:"users"`
+}
+
+func NewUserMessage(log logger.Logger, rpcClient *RPCClient) IUserMessage {
 	return &UserMessage{
-		Log: log,
+		Log:       log,
+		RPCClient: rpcClient,
 	}
 }
 
 func UserMessageFactory(log logger.Logger) IUserMessage {
-	return NewUserMessage(log)
+	return NewUserMessage(log, GetRPCClient())
 }
 
-func (m *UserMessage) SendFindUserByIDMessage(req request.SendFindUserByIDMessageRequest) (*response.SendFindUserByIDResponse, error) {
-	payload := map[string]interface{}{
-		"user_id": req.ID,
-	}
+func (m *UserMessage) SendFindUserByIDMessage(ctx context.Context, req request.SendFindUserByIDMessageRequest) (*response.SendFindUserByIDResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.RPCClient.Timeout())
+	defer cancel()
 
-	docMsg := &request.RabbitMQRequest{
-		ID:          uuid.New().String(),
-		MessageType: "find_user_by_id",
-		MessageData: payload,
-		ReplyTo:     "julong_notification",
+	reply, err := Call[findUserByIDReply](ctx, m.RPCClient, ssoQueue, "find_user_by_id", map[string]interface{}{
+		"user_id": req.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[SendFindUserByIDMessage] %w", err)
 	}
 
-	log.Printf("INFO: document message: %v", docMsg)
+	log.Printf("INFO: response: %v", reply)
 
-	// create channel and add to rchans with uid
-	rchan := make(chan response.RabbitMQResponse)
-	utils.Rchans[docMsg.ID] = rchan
+	return &response.SendFindUserByIDResponse{
+		ID:   reply.UserID,
+		Name: reply.Name,
+	}, nil
+}
 
-	// publish rabbit message
-	msg := utils.RabbitMsgPublisher{
-		QueueName: "julong_sso",
-		Message:   *docMsg,
+func (m *UserMessage) SendFindUsersByIDsMessage(ctx context.Context, req request.SendFindUsersByIDsMessageRequest) (*response.SendFindUsersByIDsResponse, error) {
+	if len(req.IDs) == 0 {
+		return &response.SendFindUsersByIDsResponse{}, nil
 	}
-	utils.Pchan <- msg
 
-	// wait for reply
-	resp, err := waitReply(docMsg.ID, rchan)
+	ctx, cancel := context.WithTimeout(ctx, m.RPCClient.Timeout())
+	defer cancel()
+
+	reply, err := Call[findUsersByIDsReply](ctx, m.RPCClient, ssoQueue, "find_users_by_ids", map[string]interface{}{
+		"user_ids": req.IDs,
+	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("[SendFindUsersByIDsMessage] %w", err)
 	}
 
-	log.Printf("INFO: response: %v", resp)
+	log.Printf("INFO: response: %v", reply)
 
-	if errMsg, ok := resp.MessageData["error"].(string); ok && errMsg != "" {
-		return nil, errors.New("[SendFindUserByIDMessage] " + errMsg)
+	users := make([]response.SendFindUserByIDResponse, 0, len(reply.Users))
+	for _, user := range reply.Users {
+		users = append(users, response.SendFindUserByIDResponse{
+			ID:   user.UserID,
+			Name: user.Name,
+		})
 	}
 
-	return &response.SendFindUserByIDResponse{
-		ID:   resp.MessageData["user_id"].(string),
-		Name: resp.MessageData["name"].(string),
+	return &response.SendFindUsersByIDsResponse{
+		Users: users,
 	}, nil
 }
 
-func (m *UserMessage) SendGetUserMe(req request.SendFindUserByIDMessageRequest) (*response.SendGetUserMeResponse, error) {
-	payload := map[string]interface{}{
-		"user_id": req.ID,
-	}
-
-	docMsg := &request.RabbitMQRequest{
-		ID:          uuid.New().String(),
-		MessageType: "get_user_me",
-		MessageData: payload,
-		ReplyTo:     "julong_notification",
-	}
-
-	log.Printf("INFO: document message: %v", docMsg)
+func (m *UserMessage) SendGetUserMe(ctx context.Context, req request.SendFindUserByIDMessageRequest) (*response.SendGetUserMeResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.RPCClient.Timeout())
+	defer cancel()
 
-	// create channel and add to rchans with uid
-	rchan := make(chan response.RabbitMQResponse)
-	utils.Rchans[docMsg.ID] = rchan
-
-	// publish rabbit message
-	msg := utils.RabbitMsgPublisher{
-		QueueName: "julong_sso",
-		Message:   *docMsg,
-	}
-	utils.Pchan <- msg
-
-	// wait for reply
-	resp, err := waitReply(docMsg.ID, rchan)
+	user, err := Call[map[string]interface{}](ctx, m.RPCClient, ssoQueue, "get_user_me", map[string]interface{}{
+		"user_id": req.ID,
+	})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("[SendGetUserMe] %w", err)
 	}
 
-	log.Printf("INFO: response: %v", resp)
-
-	if errMsg, ok := resp.MessageData["error"].(string); ok && errMsg != "" {
-		return nil, errors.New("[SendGetUserMe] " + errMsg)
-	}
+	log.Printf("INFO: response: %v", *user)
 
 	return &response.SendGetUserMeResponse{
-		User: resp.MessageData,
+		User: *user,
 	}, nil
 }
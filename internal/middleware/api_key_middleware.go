@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+type IApiKeyMiddleware interface {
+	Authenticate() gin.HandlerFunc
+}
+
+type ApiKeyMiddleware struct {
+	log           logger.Logger
+	apiKeyUseCase usecase.IApiKeyUseCase
+}
+
+func NewApiKeyMiddleware(log logger.Logger, apiKeyUseCase usecase.IApiKeyUseCase) IApiKeyMiddleware {
+	return &ApiKeyMiddleware{
+		log:           log,
+		apiKeyUseCase: apiKeyUseCase,
+	}
+}
+
+// Authenticate resolves the X-API-Key header to a service principal.
+func (m *ApiKeyMiddleware) Authenticate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(apiKeyHeader)
+		if key == "" {
+			utils.ErrorResponse(ctx, http.StatusUnauthorized, "Unauthorized", "Missing API key")
+			ctx.Abort()
+			return
+		}
+
+		principal, err := m.apiKeyUseCase.Authenticate(key)
+		if err != nil {
+			if errors.Is(err, usecase.ErrInvalidApiKey) {
+				utils.ErrorResponse(ctx, http.StatusUnauthorized, "Unauthorized", "Invalid API key")
+			} else {
+				m.log.GetLogger().Error("Failed to authenticate api key: ", "error", err)
+				utils.ErrorResponse(ctx, http.StatusInternalServerError, "Failed to authenticate API key", err.Error())
+			}
+			ctx.Abort()
+			return
+		}
+
+		ctx.Set(principalContextKey, principal)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	principalContextKey = "principal"
+	tokenQueryParam     = "token"
+)
+
+// JWTClaims is the subset of the SSO access token we rely on. The user ID is
+// read from the "user_id" claim and falls back to the standard "sub" claim.
+type JWTClaims struct {
+	UserID       string   `json:"user_id"`
+	Roles        []string `json:"roles"`
+	Applications []string `json:"applications"` // of a SERVICE, "*" grants every application
+	jwt.RegisteredClaims
+}
+
+type IJWTMiddleware interface {
+	Authenticate() gin.HandlerFunc
+	ParseToken(tokenString string) (*JWTClaims, error)
+}
+
+type JWTMiddleware struct {
+	log       logger.Logger
+	issuer    string
+	method    string
+	secret    []byte
+	publicKey *rsa.PublicKey
+}
+
+func NewJWTMiddleware(conf config.Config, log logger.Logger) IJWTMiddleware {
+	m, err := newJWTMiddleware(conf.Jwt, log)
+	if err != nil {
+		log.GetLogger().Fatal("Failed to initialize JWT middleware: ", err)
+	}
+	return m
+}
+
+// newJWTMiddleware refuses to start without a verification key, since jwt
+// accepts tokens signed with an empty HMAC secret.
+func newJWTMiddleware(conf *config.Jwt, log logger.Logger) (*JWTMiddleware, error) {
+	if conf == nil {
+		return nil, errors.New("jwt config is missing")
+	}
+	if conf.Secret == "" && conf.PublicKey == "" {
+		return nil, errors.New("jwt.secret or jwt.public_key must be set")
+	}
+
+	m := &JWTMiddleware{
+		log:    log,
+		issuer: conf.Issuer,
+		method: jwt.SigningMethodHS256.Alg(),
+		secret: []byte(conf.Secret),
+	}
+
+	if conf.PublicKey != "" {
+		pem, err := os.ReadFile(conf.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("read public key: %w", err)
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key: %w", err)
+		}
+		m.method = jwt.SigningMethodRS256.Alg()
+		m.publicKey = publicKey
+	}
+
+	return m, nil
+}
+
+func JWTMiddlewareFactory(conf config.Config, log logger.Logger) IJWTMiddleware {
+	return NewJWTMiddleware(conf, log)
+}
+
+// Authenticate validates the bearer token and stores the verified principal on
+// the gin context. Browsers cannot set headers on a WebSocket handshake, so
+// the token may also be passed as the "token" query parameter.
+func (m *JWTMiddleware) Authenticate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tokenString := extractToken(ctx)
+		if tokenString == "" {
+			utils.ErrorResponse(ctx, http.StatusUnauthorized, "Unauthorized", "Missing bearer token")
+			ctx.Abort()
+			return
+		}
+
+		claims, err := m.ParseToken(tokenString)
+		if err != nil {
+			m.log.GetLogger().Error("Failed to parse token: ", "error", err)
+			utils.ErrorResponse(ctx, http.StatusUnauthorized, "Unauthorized", "Invalid token")
+			ctx.Abort()
+			return
+		}
+
+		userID, err := claims.GetUserID()
+		if err != nil {
+			m.log.GetLogger().Error("Invalid user ID in token: ", "error", err)
+			utils.ErrorResponse(ctx, http.StatusUnauthorized, "Unauthorized", "Invalid token")
+			ctx.Abort()
+			return
+		}
+
+		ctx.Set(principalContextKey, claims.ToPrincipal(userID))
+		ctx.Next()
+	}
+}
+
+func (m *JWTMiddleware) ParseToken(tokenString string) (*JWTClaims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{m.method}),
+		jwt.WithExpirationRequired(),
+	}
+	if m.issuer != "" {
+		options = append(options, jwt.WithIssuer(m.issuer))
+	}
+
+	claims := &JWTClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if m.publicKey != nil {
+			return m.publicKey, nil
+		}
+		return m.secret, nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (c *JWTClaims) GetUserID() (uuid.UUID, error) {
+	userID := c.UserID
+	if userID == "" {
+		userID = c.Subject
+	}
+	if userID == "" {
+		return uuid.Nil, errors.New("user ID claim is missing")
+	}
+	return uuid.Parse(userID)
+}
+
+// ToPrincipal maps the "roles" claim onto a principal. Tokens without an
+// admin or service role belong to an end user.
+func (c *JWTClaims) ToPrincipal(userID uuid.UUID) *auth.Principal {
+	principal := auth.NewUserPrincipal(userID)
+	for _, role := range c.Roles {
+		switch auth.Role(strings.ToUpper(role)) {
+		case auth.RoleAdmin:
+			principal.Role = auth.RoleAdmin
+			return principal
+		case auth.RoleService:
+			principal.Role = auth.RoleService
+			principal.Applications = c.Applications
+		}
+	}
+	return principal
+}
+
+// GetPrincipal returns the principal stored by Authenticate.
+func GetPrincipal(ctx *gin.Context) (*auth.Principal, bool) {
+	value, ok := ctx.Get(principalContextKey)
+	if !ok {
+		return nil, false
+	}
+	principal, ok := value.(*auth.Principal)
+	return principal, ok
+}
+
+func extractToken(ctx *gin.Context) string {
+	header := ctx.GetHeader("Authorization")
+	if header != "" {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			return strings.TrimSpace(parts[1])
+		}
+		return ""
+	}
+	return ctx.Query(tokenQueryParam)
+}
+
+// RedactToken masks the token query parameter of a logged request path.
+func RedactToken(path string) string {
+	i := strings.IndexByte(path, '?')
+	if i < 0 {
+		return path
+	}
+
+	query, err := url.ParseQuery(path[i+1:])
+	if err != nil {
+		return path[:i]
+	}
+	if query.Has(tokenQueryParam) {
+		query.Set(tokenQueryParam, "REDACTED")
+	}
+	return path[:i+1] + query.Encode()
+}
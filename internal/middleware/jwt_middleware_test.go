@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	testSecret = "test-secret"
+	testIssuer = "test-sso"
+)
+
+func newTestMiddleware(t *testing.T, conf *config.Jwt) *JWTMiddleware {
+	t.Helper()
+	m, err := newJWTMiddleware(conf, logger.NewLogger())
+	if err != nil {
+		t.Fatalf("newJWTMiddleware: %v", err)
+	}
+	return m
+}
+
+func newRSAMiddleware(t *testing.T) (*JWTMiddleware, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "public.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write public key: %v", err)
+	}
+	return newTestMiddleware(t, &config.Jwt{PublicKey: path, Issuer: testIssuer}), key
+}
+
+func validClaims(userID uuid.UUID) *JWTClaims {
+	return &JWTClaims{
+		UserID: userID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestNewJWTMiddlewareRequiresKey(t *testing.T) {
+	for name, conf := range map[string]*config.Jwt{
+		"missing config": nil,
+		"empty secret":   {Issuer: testIssuer},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newJWTMiddleware(conf, logger.NewLogger()); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	hmac := newTestMiddleware(t, &config.Jwt{Secret: testSecret, Issuer: testIssuer})
+	rsaMiddleware, rsaKey := newRSAMiddleware(t)
+	userID := uuid.New()
+
+	expired := validClaims(userID)
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+
+	wrongIssuer := validClaims(userID)
+	wrongIssuer.Issuer = "someone-else"
+
+	noExpiry := validClaims(userID)
+	noExpiry.ExpiresAt = nil
+
+	tests := []struct {
+		name       string
+		middleware *JWTMiddleware
+		token      string
+		wantErr    bool
+	}{
+		{"valid HS256", hmac, sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims(userID)), false},
+		{"valid RS256", rsaMiddleware, sign(t, jwt.SigningMethodRS256, rsaKey, validClaims(userID)), false},
+		{"expired", hmac, sign(t, jwt.SigningMethodHS256, []byte(testSecret), expired), true},
+		{"missing expiry", hmac, sign(t, jwt.SigningMethodHS256, []byte(testSecret), noExpiry), true},
+		{"wrong issuer", hmac, sign(t, jwt.SigningMethodHS256, []byte(testSecret), wrongIssuer), true},
+		{"wrong secret", hmac, sign(t, jwt.SigningMethodHS256, []byte("other-secret"), validClaims(userID)), true},
+		{"HS256 against RS256", rsaMiddleware, sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims(userID)), true},
+		{"RS256 against HS256", hmac, sign(t, jwt.SigningMethodRS256, rsaKey, validClaims(userID)), true},
+		{"alg none", hmac, sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims(userID)), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.middleware.ParseToken(tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if got, _ := claims.GetUserID(); got != userID {
+				t.Fatalf("user ID = %s, want %s", got, userID)
+			}
+		})
+	}
+}
+
+func TestGetUserIDFallsBackToSubject(t *testing.T) {
+	userID := uuid.New()
+
+	claims := &JWTClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: userID.String()}}
+	if got, err := claims.GetUserID(); err != nil || got != userID {
+		t.Fatalf("GetUserID() = %s, %v, want %s", got, err, userID)
+	}
+
+	claims = &JWTClaims{UserID: userID.String(), RegisteredClaims: jwt.RegisteredClaims{Subject: uuid.NewString()}}
+	if got, _ := claims.GetUserID(); got != userID {
+		t.Fatalf("user_id claim should win over sub, got %s", got)
+	}
+
+	if _, err := (&JWTClaims{}).GetUserID(); err == nil {
+		t.Fatal("expected an error without user_id and sub")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newTestMiddleware(t, &config.Jwt{Secret: testSecret, Issuer: testIssuer})
+	userID := uuid.New()
+	token := sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims(userID))
+
+	router := gin.New()
+	router.GET("/", m.Authenticate(), func(ctx *gin.Context) {
+		principal, _ := GetPrincipal(ctx)
+		if principal.UserID != userID || principal.Role != auth.RoleUser {
+			t.Errorf("principal = %+v", principal)
+		}
+		ctx.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   int
+	}{
+		{"bearer header", "/", "Bearer " + token, http.StatusOK},
+		{"query token", "/?token=" + token, "", http.StatusOK},
+		{"missing token", "/", "", http.StatusUnauthorized},
+		{"non bearer header", "/?token=" + token, "Basic " + token, http.StatusUnauthorized},
+		{"invalid token", "/", "Bearer not-a-token", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactToken(t *testing.T) {
+	tests := map[string]string{
+		"/ws":                       "/ws",
+		"/ws?token=secret":          "/ws?token=REDACTED",
+		"/ws?app_type=a&token=abc":  "/ws?app_type=a&token=REDACTED",
+		"/api/v1/notifications?x=1": "/api/v1/notifications?x=1",
+	}
+	for path, want := range tests {
+		if got := RedactToken(path); got != want {
+			t.Errorf("RedactToken(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole must run after an authentication middleware.
+func RequireRole(roles ...auth.Role) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, ok := GetPrincipal(ctx)
+		if !ok {
+			utils.ErrorResponse(ctx, http.StatusUnauthorized, "Unauthorized", "Unauthorized")
+			ctx.Abort()
+			return
+		}
+
+		for _, role := range roles {
+			if principal.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+
+		utils.ErrorResponse(ctx, http.StatusForbidden, "Forbidden", "Forbidden")
+		ctx.Abort()
+	}
+}
@@ -0,0 +1,232 @@
+package rabbitmq
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/websocket"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// FanoutBackplane shares WebSocket broadcasts between instances through the
+// "<queue>.ws" fanout exchange. Every instance binds its own exclusive queue,
+// so each one receives every envelope, its own included.
+//
+// Publish only queues the envelope; a single goroutine started by Run drains
+// the queue onto the broker, so a slow broker never holds up the request that
+// broadcast.
+type FanoutBackplane struct {
+	log      logger.Logger
+	manager  *ConnectionManager
+	exchange string
+	deliver  func(websocket.Envelope)
+	channel  *amqp091.Channel // publishing channel, nil while disconnected
+	mu       sync.Mutex
+
+	outgoing chan backplanePublishing
+	dropped  uint64
+}
+
+// backplanePublishing is an envelope waiting for the publisher goroutine.
+type backplanePublishing struct {
+	envelope websocket.Envelope
+	body     []byte
+}
+
+// BackplaneMetrics is reported by the metrics endpoint.
+type BackplaneMetrics struct {
+	PublishQueued  int    `json:"publish_queued"`  // envelopes waiting to be published
+	PublishDropped uint64 `json:"publish_dropped"` // envelopes dropped because the publish queue was full
+}
+
+func NewFanoutBackplane(conf config.Config, log logger.Logger, manager *ConnectionManager) *FanoutBackplane {
+	buffer := defaultPublishBuffer
+	if conf.Websocket != nil && conf.Websocket.BroadcastBuffer > 0 {
+		buffer = conf.Websocket.BroadcastBuffer
+	}
+	return &FanoutBackplane{
+		log:      log,
+		manager:  manager,
+		exchange: conf.RabbitMq.Queue + ".ws",
+		outgoing: make(chan backplanePublishing, buffer),
+	}
+}
+
+const defaultPublishBuffer = 1024
+
+func (b *FanoutBackplane) Subscribe(deliver func(websocket.Envelope)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliver = deliver
+}
+
+// Publish never blocks the caller. While disconnected it fails so the hub
+// delivers locally; when the publish queue is full the envelope is dropped and
+// counted, and clients recover it through replay.
+func (b *FanoutBackplane) Publish(envelope websocket.Envelope) error {
+	body, err := websocket.MarshalBackplaneMessage(envelope)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	connected := b.channel != nil
+	b.mu.Unlock()
+	if !connected {
+		return ErrNotConnected
+	}
+
+	select {
+	case b.outgoing <- backplanePublishing{envelope: envelope, body: body}:
+	default:
+		atomic.AddUint64(&b.dropped, 1)
+		b.log.GetLogger().Printf("ERROR: backplane publish queue is full, dropping %s event %s", envelope.Type, envelope.ID)
+	}
+	return nil
+}
+
+func (b *FanoutBackplane) Metrics() BackplaneMetrics {
+	return BackplaneMetrics{
+		PublishQueued:  len(b.outgoing),
+		PublishDropped: atomic.LoadUint64(&b.dropped),
+	}
+}
+
+// publish drains the publish queue. An envelope that cannot be published is
+// delivered to the local clients, as Hub.Broadcast does for a failed Publish.
+func (b *FanoutBackplane) publish() {
+	for publishing := range b.outgoing {
+		if err := b.publishBody(publishing.body); err != nil {
+			b.log.GetLogger().Printf("ERROR: fail publish backplane msg, delivering locally: %s", err.Error())
+
+			b.mu.Lock()
+			deliver := b.deliver
+			b.mu.Unlock()
+			if deliver != nil {
+				deliver(publishing.envelope)
+			}
+		}
+	}
+}
+
+func (b *FanoutBackplane) publishBody(body []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.channel == nil {
+		return ErrNotConnected
+	}
+	return b.channel.Publish(
+		b.exchange, // exchange
+		"",         // routing key
+		false,      // mandatory
+		false,      // immediate
+		amqp091.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+		},
+	)
+}
+
+// Run consumes the exchange for the lifetime of the process, binding a new
+// queue after every reconnect, and publishes what Publish queued.
+func (b *FanoutBackplane) Run() {
+	go b.publish()
+
+	for {
+		conn := b.manager.Connection()
+
+		err := b.consume(conn)
+		if err != nil {
+			b.log.GetLogger().Printf("ERROR: websocket backplane stopped: %s", err.Error())
+		} else {
+			b.log.GetLogger().Printf("ERROR: websocket backplane stopped: delivery channel closed")
+		}
+	}
+}
+
+func (b *FanoutBackplane) consume(conn *amqp091.Connection) error {
+	amqpChannel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer amqpChannel.Close()
+
+	if err := amqpChannel.ExchangeDeclare(
+		b.exchange, // name
+		"fanout",   // kind
+		true,       // durable
+		false,      // auto-delete
+		false,      // internal
+		false,      // no-wait
+		nil,        // arguments
+	); err != nil {
+		return err
+	}
+
+	queue, err := amqpChannel.QueueDeclare(
+		"",    // server-named
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := amqpChannel.QueueBind(queue.Name, "", b.exchange, false, nil); err != nil {
+		return err
+	}
+
+	msgChannel, err := amqpChannel.Consume(
+		queue.Name, // queue
+		"",         // consumer
+		true,       // auto-ack, a missed broadcast is replayed on reconnect
+		true,       // exclusive
+		false,      // no-local
+		false,      // no-wait
+		nil,        // args
+	)
+	if err != nil {
+		return err
+	}
+
+	publishChannel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	b.setChannel(publishChannel)
+	defer func() {
+		b.setChannel(nil)
+		publishChannel.Close()
+	}()
+
+	b.log.GetLogger().Printf("INFO: done init websocket backplane")
+
+	for msg := range msgChannel {
+		envelope, err := websocket.UnmarshalBackplaneMessage(msg.Body)
+		if err != nil {
+			b.log.GetLogger().Printf("ERROR: fail unmarshal backplane msg: %s", msg.Body)
+			continue
+		}
+
+		b.mu.Lock()
+		deliver := b.deliver
+		b.mu.Unlock()
+		if deliver != nil {
+			deliver(envelope)
+		}
+	}
+
+	return nil
+}
+
+func (b *FanoutBackplane) setChannel(channel *amqp091.Channel) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.channel = channel
+}
@@ -0,0 +1,72 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/websocket"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/google/uuid"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func newTestBackplane(buffer int) *FanoutBackplane {
+	conf := config.Config{
+		RabbitMq:  &config.RabbitMq{Queue: "julong_notification"},
+		Websocket: &config.Websocket{BroadcastBuffer: buffer},
+	}
+	return NewFanoutBackplane(conf, logger.NewLogger(), nil)
+}
+
+func TestFanoutBackplanePublishDoesNotBlock(t *testing.T) {
+	b := newTestBackplane(2)
+	envelope := websocket.NewEnvelope(websocket.EventNotificationCreated, uuid.New(), "mpp", nil)
+
+	if err := b.Publish(envelope); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("Publish() while disconnected = %v, want ErrNotConnected", err)
+	}
+
+	// connected, but the publisher goroutine is not draining
+	b.setChannel(&amqp091.Channel{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			if err := b.Publish(envelope); err != nil {
+				t.Errorf("Publish: %v", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full queue")
+	}
+
+	if metrics := b.Metrics(); metrics.PublishQueued != 2 || metrics.PublishDropped != 3 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+}
+
+func TestFanoutBackplaneDeliversLocallyWhenPublishFails(t *testing.T) {
+	b := newTestBackplane(1)
+	delivered := make(chan websocket.Envelope, 1)
+	b.Subscribe(func(envelope websocket.Envelope) { delivered <- envelope })
+
+	// the connection went away after the envelope was queued
+	envelope := websocket.NewEnvelope(websocket.EventNotificationCreated, uuid.New(), "mpp", nil)
+	b.outgoing <- backplanePublishing{envelope: envelope}
+	go b.publish()
+	defer close(b.outgoing)
+
+	select {
+	case got := <-delivered:
+		if got.ID != envelope.ID {
+			t.Fatalf("delivered %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("envelope was lost")
+	}
+}
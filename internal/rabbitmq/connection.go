@@ -0,0 +1,161 @@
+package rabbitmq
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+var ErrNotConnected = errors.New("rabbitmq is not connected")
+
+type ConnectionState string
+
+const (
+	StateConnecting   ConnectionState = "CONNECTING"
+	StateConnected    ConnectionState = "CONNECTED"
+	StateReconnecting ConnectionState = "RECONNECTING"
+)
+
+const (
+	minReconnectDelay = 1 * time.Second
+	maxReconnectDelay = 30 * time.Second
+)
+
+// ConnectionManager owns the broker connection. It redials with exponential
+// backoff whenever the connection is closed, and lets the consumer and the
+// producer block until a live connection is available again.
+type ConnectionManager struct {
+	conf      config.Config
+	log       logger.Logger
+	conn      *amqp091.Connection
+	state     ConnectionState
+	lastError string
+	since     time.Time
+	ready     chan struct{} // closed while connected
+	mu        sync.RWMutex
+}
+
+// ConnectionStatus is reported by the health endpoint.
+type ConnectionStatus struct {
+	State     ConnectionState `json:"state"`
+	Since     time.Time       `json:"since"`
+	LastError string          `json:"last_error,omitempty"`
+}
+
+func NewConnectionManager(conf config.Config, log logger.Logger) *ConnectionManager {
+	return &ConnectionManager{
+		conf:  conf,
+		log:   log,
+		state: StateConnecting,
+		since: time.Now(),
+		ready: make(chan struct{}),
+	}
+}
+
+// Run keeps the connection alive for the lifetime of the process.
+func (m *ConnectionManager) Run() {
+	delay := minReconnectDelay
+	for {
+		conn, err := amqp091.Dial(m.conf.RabbitMq.Host)
+		if err != nil {
+			m.log.GetLogger().Printf("ERROR: fail connect rabbitmq, retrying in %s: %s", delay, err.Error())
+			m.setError(err)
+			time.Sleep(delay)
+			delay *= 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+
+		delay = minReconnectDelay
+		closeChan := conn.NotifyClose(make(chan *amqp091.Error, 1))
+		m.setConnected(conn)
+		m.log.GetLogger().Printf("INFO: rabbitmq connected")
+
+		if closeErr, ok := <-closeChan; ok && closeErr != nil {
+			m.log.GetLogger().Printf("ERROR: rabbitmq connection closed: %s", closeErr.Error())
+			m.setDisconnected(closeErr.Error())
+		} else {
+			m.log.GetLogger().Printf("ERROR: rabbitmq connection closed")
+			m.setDisconnected("connection closed")
+		}
+	}
+}
+
+// Connection blocks until the broker is connected.
+func (m *ConnectionManager) Connection() *amqp091.Connection {
+	for {
+		m.mu.RLock()
+		conn, ready := m.conn, m.ready
+		connected := m.state == StateConnected
+		m.mu.RUnlock()
+
+		if connected {
+			if !conn.IsClosed() {
+				return conn
+			}
+			// Run has not observed the close yet
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		<-ready
+	}
+}
+
+// CurrentConnection returns the live connection without waiting, for callers
+// such as HTTP handlers that should fail fast while the broker is down.
+func (m *ConnectionManager) CurrentConnection() (*amqp091.Connection, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.state != StateConnected || m.conn.IsClosed() {
+		return nil, ErrNotConnected
+	}
+	return m.conn, nil
+}
+
+func (m *ConnectionManager) State() ConnectionState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+func (m *ConnectionManager) Status() ConnectionStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return ConnectionStatus{
+		State:     m.state,
+		Since:     m.since,
+		LastError: m.lastError,
+	}
+}
+
+func (m *ConnectionManager) setConnected(conn *amqp091.Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conn = conn
+	m.state = StateConnected
+	m.since = time.Now()
+	m.lastError = ""
+	close(m.ready)
+}
+
+func (m *ConnectionManager) setDisconnected(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conn = nil
+	m.state = StateReconnecting
+	m.since = time.Now()
+	m.lastError = reason
+	m.ready = make(chan struct{})
+}
+
+func (m *ConnectionManager) setError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastError = err.Error()
+}
@@ -1,34 +1,49 @@
 package rabbitmq
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
-	"os"
+	"sync"
+	"time"
 
 	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/messaging"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
 	"github.com/IlhamSetiaji/julong-notification-be/logger"
-	"github.com/IlhamSetiaji/julong-notification-be/utils"
 	"github.com/rabbitmq/amqp091-go"
 )
 
-func InitConsumer(conf config.Config, log logger.Logger) {
-	// conn
-	conn, err := amqp091.Dial(conf.RabbitMq.Host)
-	if err != nil {
-		log.GetLogger().Printf("ERROR: fail init consumer: %s", err.Error())
-		os.Exit(1)
-	}
+const (
+	defaultPrefetch = 32
+	defaultWorkers  = 8
+)
+
+// apiKeyHeader carries the API key a producer authenticates its messages with.
+const apiKeyHeader = "x-api-key"
 
-	log.GetLogger().Printf("INFO: done init consumer conn")
+// InitConsumer consumes conf.RabbitMq.Queue for the lifetime of the process,
+// re-declaring the queues and restarting the consumer after every reconnect.
+func InitConsumer(conf config.Config, log logger.Logger, manager *ConnectionManager, deadLetter *DeadLetterQueue, router *Router) {
+	for {
+		conn := manager.Connection()
+
+		err := consume(conn, conf, log, deadLetter, router)
+		if err != nil {
+			log.GetLogger().Printf("ERROR: consumer stopped: %s", err.Error())
+		} else {
+			log.GetLogger().Printf("ERROR: consumer stopped: delivery channel closed")
+		}
+	}
+}
 
+func consume(conn *amqp091.Connection, conf config.Config, log logger.Logger, deadLetter *DeadLetterQueue, router *Router) error {
 	// create channel
 	amqpChannel, err := conn.Channel()
 	if err != nil {
-		log.GetLogger().Printf("ERROR: fail create channel: %s", err.Error())
-		os.Exit(1)
+		return err
 	}
+	defer amqpChannel.Close()
 
 	// create queue
 	queue, err := amqpChannel.QueueDeclare(
@@ -40,8 +55,17 @@ func InitConsumer(conf config.Config, log logger.Logger) {
 		nil,                 // arguments
 	)
 	if err != nil {
-		log.GetLogger().Printf("ERROR: fail create queue: %s", err.Error())
-		os.Exit(1)
+		return err
+	}
+
+	if err := deadLetter.Declare(amqpChannel); err != nil {
+		return err
+	}
+
+	// the broker holds back deliveries beyond prefetch until earlier ones are acked
+	prefetch, workers := consumerLimits(conf)
+	if err := amqpChannel.Qos(prefetch, 0, false); err != nil {
+		return err
 	}
 
 	// channel
@@ -55,74 +79,156 @@ func InitConsumer(conf config.Config, log logger.Logger) {
 		nil,        // args
 	)
 	if err != nil {
-		log.GetLogger().Printf("ERROR: fail create channel: %s", err.Error())
-		os.Exit(1)
+		return err
 	}
 
-	// consume
-	for {
-		select {
-		case msg := <-msgChannel:
-			// unmarshal
-			docRply := &response.RabbitMQResponse{}
-			docMsg := &request.RabbitMQRequest{}
-			err = json.Unmarshal(msg.Body, docRply)
-			if err != nil {
-				log.GetLogger().Printf("ERROR: fail unmarshl: %s", msg.Body)
-				msg.Nack(false, true)
-				continue
-			}
-			log.GetLogger().Printf("INFO: received docRply: %v", docRply)
+	log.GetLogger().Printf("INFO: done init consumer")
 
-			err = json.Unmarshal(msg.Body, docMsg)
-			if err != nil {
-				log.GetLogger().Printf("ERROR: fail unmarshl: %s", msg.Body)
-				msg.Nack(false, true)
-				continue
+	// handlers still waiting on RPC replies give up once the consumer stops,
+	// before the workers are waited for
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs := make(chan consumerJob, prefetch)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				handleDelivery(ctx, log, deadLetter, router, amqpChannel, job)
 			}
-			log.GetLogger().Printf("INFO: received docMsg: %v", docMsg)
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+	defer cancel()
 
-			// ack for message
-			err = msg.Ack(true)
-			if err != nil {
-				log.GetLogger().Printf("ERROR: fail to ack: %s", err.Error())
-			}
+	// consume until the channel or the connection is closed
+	for msg := range msgChannel {
+		// unmarshal
+		docRply := &response.RabbitMQResponse{}
+		docMsg := &request.RabbitMQRequest{}
+		err = json.Unmarshal(msg.Body, docRply)
+		if err != nil {
+			log.GetLogger().Printf("ERROR: fail unmarshl: %s", msg.Body)
+			// a body that cannot be decoded will never succeed, skip the retries
+			deadLetter.Reject(amqpChannel, msg, err)
+			continue
+		}
+		log.GetLogger().Printf("INFO: received docRply: %v", docRply)
 
-			// find waiting channel(with uid) and forward the reply to it
-			if rchan, ok := utils.Rchans[docRply.ID]; ok {
-				rchan <- *docRply
-			}
+		err = json.Unmarshal(msg.Body, docMsg)
+		if err != nil {
+			log.GetLogger().Printf("ERROR: fail unmarshl: %s", msg.Body)
+			deadLetter.Reject(amqpChannel, msg, err)
+			continue
+		}
+		log.GetLogger().Printf("INFO: received docMsg: %v", docMsg)
+		docMsg.ApiKey, _ = msg.Headers[apiKeyHeader].(string)
 
-			handleMsg(docMsg, log, conf)
+		// forward the reply to the caller waiting on its uid. Replies never
+		// wait for a worker, the workers may be waiting on exactly them.
+		if docMsg.MessageType == "reply" {
+			if !messaging.GetRPCClient().Deliver(*docRply) {
+				log.GetLogger().Printf("INFO: dropped reply without a waiting caller: %s", docRply.ID)
+			}
+			if err := msg.Ack(false); err != nil {
+				log.GetLogger().Printf("ERROR: fail to ack: %s", err.Error())
+			}
+			continue
 		}
+
+		// jobs holds prefetch deliveries, so this never blocks the loop
+		jobs <- consumerJob{msg: msg, docMsg: docMsg}
 	}
+
+	return nil
 }
 
-func handleMsg(docMsg *request.RabbitMQRequest, log logger.Logger, conf config.Config) {
-	// switch case
-	var msgData map[string]interface{}
+// consumerJob is a decoded delivery waiting for a worker.
+type consumerJob struct {
+	msg    amqp091.Delivery
+	docMsg *request.RabbitMQRequest
+}
 
-	switch docMsg.MessageType {
-	case "reply":
-		log.GetLogger().Printf("INFO: received reply message")
+func handleDelivery(ctx context.Context, log logger.Logger, deadLetter *DeadLetterQueue, router *Router, amqpChannel *amqp091.Channel, job consumerJob) {
+	if err := router.Dispatch(ctx, job.docMsg); err != nil {
+		log.GetLogger().Printf("ERROR: fail handle msg: %s", err.Error())
+		deadLetter.Retry(amqpChannel, job.msg, err)
 		return
-	default:
-		log.GetLogger().Printf("Unknown message type, please recheck your type: %s", docMsg.MessageType)
+	}
 
-		msgData = map[string]interface{}{
-			"error": errors.New("unknown message type").Error(),
-		}
+	// ack for message
+	if err := job.msg.Ack(false); err != nil {
+		log.GetLogger().Printf("ERROR: fail to ack: %s", err.Error())
+	}
+}
+
+// consumerLimits falls back to the defaults and never runs more workers than
+// there can be deliveries.
+func consumerLimits(conf config.Config) (prefetch int, workers int) {
+	prefetch, workers = conf.RabbitMq.Prefetch, conf.RabbitMq.Workers
+	if prefetch <= 0 {
+		prefetch = defaultPrefetch
+	}
+	if workers <= 0 {
+		workers = defaultWorkers
 	}
-	// reply
-	reply := response.RabbitMQResponse{
-		ID: docMsg.ID,
-		// MessageType: docMsg.MessageType,
-		MessageType: "reply",
-		MessageData: msgData,
+	if workers > prefetch {
+		workers = prefetch
+	}
+	return prefetch, workers
+}
+
+// NewReplyConsumer declares an exclusive, auto-delete reply queue named by the
+// broker and returns an RPC client whose replies are consumed from it. It is
+// meant for one-off commands: the queue goes away with conn and nothing is
+// left behind on the broker.
+func NewReplyConsumer(conn *amqp091.Connection, log logger.Logger, timeout time.Duration) (*messaging.RPCClient, error) {
+	amqpChannel, err := conn.Channel()
+	if err != nil {
+		return nil, err
 	}
-	msg := utils.RabbitMsgConsumer{
-		QueueName: docMsg.ReplyTo,
-		Reply:     reply,
+
+	queue, err := amqpChannel.QueueDeclare(
+		"",    // name, chosen by the broker
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		amqpChannel.Close()
+		return nil, err
 	}
-	utils.Rchan <- msg
+
+	msgChannel, err := amqpChannel.Consume(
+		queue.Name, // queue
+		"",         // consumer
+		true,       // auto-ack
+		true,       // exclusive
+		false,      // no-local
+		false,      // no-wait
+		nil,        // args
+	)
+	if err != nil {
+		amqpChannel.Close()
+		return nil, err
+	}
+
+	rpcClient := messaging.NewRPCClient(queue.Name, timeout)
+	go func() {
+		defer amqpChannel.Close()
+		for msg := range msgChannel {
+			docRply := response.RabbitMQResponse{}
+			if err := json.Unmarshal(msg.Body, &docRply); err != nil {
+				log.GetLogger().Printf("ERROR: fail unmarshl: %s", msg.Body)
+				continue
+			}
+			rpcClient.Deliver(docRply)
+		}
+		log.GetLogger().Printf("ERROR: reply consumer stopped: delivery channel closed")
+	}()
+
+	return rpcClient, nil
 }
@@ -0,0 +1,27 @@
+package rabbitmq
+
+import (
+	"testing"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+)
+
+func TestConsumerLimits(t *testing.T) {
+	tests := []struct {
+		name                      string
+		prefetch, workers         int
+		wantPrefetch, wantWorkers int
+	}{
+		{"defaults", 0, 0, defaultPrefetch, defaultWorkers},
+		{"configured", 10, 4, 10, 4},
+		{"workers capped by prefetch", 2, 4, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefetch, workers := consumerLimits(config.Config{RabbitMq: &config.RabbitMq{Prefetch: tt.prefetch, Workers: tt.workers}})
+			if prefetch != tt.wantPrefetch || workers != tt.wantWorkers {
+				t.Fatalf("consumerLimits() = %d, %d", prefetch, workers)
+			}
+		})
+	}
+}
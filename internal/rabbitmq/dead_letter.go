@@ -0,0 +1,286 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultRetryDelay = 5 * time.Second
+
+	headerRetryCount    = "x-retry-count"
+	headerError         = "x-error"
+	headerFailedAt      = "x-failed-at"
+	headerOriginalQueue = "x-original-queue"
+)
+
+// DeadLetterQueue retries failed deliveries on the main queue and parks them
+// in "<queue>.dlq" once conf.RabbitMq.MaxRetries attempts are used up. The
+// retry count travels in the x-retry-count header. A retry waits in the
+// "<queue>.retry.<attempt>" delay queue, whose TTL doubles with every attempt,
+// until it expires back onto the main queue.
+type DeadLetterQueue struct {
+	conf       config.Config
+	log        logger.Logger
+	manager    *ConnectionManager
+	queue      string
+	exchange   string
+	maxRetries int
+	retryDelay time.Duration
+}
+
+func NewDeadLetterQueue(conf config.Config, log logger.Logger, manager *ConnectionManager) *DeadLetterQueue {
+	maxRetries := conf.RabbitMq.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	retryDelay := time.Duration(conf.RabbitMq.RetryDelay) * time.Second
+	if retryDelay <= 0 {
+		retryDelay = defaultRetryDelay
+	}
+	return &DeadLetterQueue{
+		conf:       conf,
+		log:        log,
+		manager:    manager,
+		queue:      conf.RabbitMq.Queue + ".dlq",
+		exchange:   conf.RabbitMq.Queue + ".dlx",
+		maxRetries: maxRetries,
+		retryDelay: retryDelay,
+	}
+}
+
+// Declare creates the dead-letter exchange and queue and the retry delay
+// queues next to the main queue.
+func (d *DeadLetterQueue) Declare(amqpChannel *amqp091.Channel) error {
+	for attempt := 1; attempt < d.maxRetries; attempt++ {
+		_, err := amqpChannel.QueueDeclare(
+			d.retryQueue(attempt), // name
+			true,                  // durable
+			false,                 // delete when unused
+			false,                 // exclusive
+			false,                 // no-wait
+			amqp091.Table{
+				"x-message-ttl":             d.backoff(attempt).Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": d.conf.RabbitMq.Queue,
+			},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := amqpChannel.ExchangeDeclare(
+		d.exchange, // name
+		"fanout",   // kind
+		true,       // durable
+		false,      // auto-delete
+		false,      // internal
+		false,      // no-wait
+		nil,        // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = amqpChannel.QueueDeclare(
+		d.queue, // name
+		true,    // durable
+		false,   // delete when unused
+		false,   // exclusive
+		false,   // no-wait
+		nil,     // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	return amqpChannel.QueueBind(d.queue, "", d.exchange, false, nil)
+}
+
+// Retry republishes a failed delivery to the delay queue of its attempt with
+// an incremented retry count, or dead-letters it when no attempts are left.
+func (d *DeadLetterQueue) Retry(amqpChannel *amqp091.Channel, msg amqp091.Delivery, cause error) {
+	retries := retryCount(msg.Headers) + 1
+	if retries >= d.maxRetries {
+		d.Reject(amqpChannel, msg, cause)
+		return
+	}
+
+	headers := copyHeaders(msg.Headers)
+	headers[headerRetryCount] = int32(retries)
+	headers[headerError] = cause.Error()
+
+	err := amqpChannel.Publish("", d.retryQueue(retries), false, false, republishing(msg, headers))
+	if err != nil {
+		d.log.GetLogger().Printf("ERROR: fail republish msg for retry: %s", err.Error())
+		msg.Nack(false, true)
+		return
+	}
+
+	d.log.GetLogger().Printf("INFO: msg scheduled for retry %d/%d in %s: %s", retries, d.maxRetries, d.backoff(retries), cause.Error())
+	msg.Ack(false)
+}
+
+// Reject sends a delivery straight to the dead-letter queue with the error
+// attached, e.g. for a body that can never be decoded.
+func (d *DeadLetterQueue) Reject(amqpChannel *amqp091.Channel, msg amqp091.Delivery, cause error) {
+	headers := copyHeaders(msg.Headers)
+	headers[headerRetryCount] = int32(retryCount(msg.Headers))
+	headers[headerError] = cause.Error()
+	headers[headerFailedAt] = time.Now().Format(time.RFC3339)
+	headers[headerOriginalQueue] = d.conf.RabbitMq.Queue
+
+	err := amqpChannel.Publish(d.exchange, "", false, false, republishing(msg, headers))
+	if err != nil {
+		d.log.GetLogger().Printf("ERROR: fail dead-letter msg: %s", err.Error())
+		msg.Nack(false, true)
+		return
+	}
+
+	d.log.GetLogger().Printf("ERROR: msg dead-lettered: %s", cause.Error())
+	msg.Ack(false)
+}
+
+// Inspect returns up to limit dead-lettered messages without removing them.
+func (d *DeadLetterQueue) Inspect(limit int) ([]response.DeadLetterResponse, error) {
+	conn, err := d.manager.CurrentConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	amqpChannel, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	// closing the channel requeues every message fetched without an ack
+	defer amqpChannel.Close()
+
+	messages := []response.DeadLetterResponse{}
+	for len(messages) < limit {
+		msg, ok, err := amqpChannel.Get(d.queue, false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		messages = append(messages, convertDeadLetter(msg))
+	}
+
+	return messages, nil
+}
+
+// Replay moves up to limit dead-lettered messages back to the main queue with
+// their retry count reset.
+func (d *DeadLetterQueue) Replay(limit int) (int, error) {
+	conn, err := d.manager.CurrentConnection()
+	if err != nil {
+		return 0, err
+	}
+
+	amqpChannel, err := conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer amqpChannel.Close()
+
+	replayed := 0
+	for replayed < limit {
+		msg, ok, err := amqpChannel.Get(d.queue, false)
+		if err != nil {
+			return replayed, err
+		}
+		if !ok {
+			break
+		}
+
+		headers := copyHeaders(msg.Headers)
+		delete(headers, headerRetryCount)
+		delete(headers, headerError)
+		delete(headers, headerFailedAt)
+		delete(headers, headerOriginalQueue)
+
+		err = amqpChannel.Publish("", d.conf.RabbitMq.Queue, false, false, republishing(msg, headers))
+		if err != nil {
+			msg.Nack(false, true)
+			return replayed, err
+		}
+
+		if err := msg.Ack(false); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+
+	d.log.GetLogger().Printf("INFO: replayed %d dead-lettered msgs", replayed)
+	return replayed, nil
+}
+
+func (d *DeadLetterQueue) retryQueue(attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", d.conf.RabbitMq.Queue, attempt)
+}
+
+// backoff is the delay before the given retry attempt.
+func (d *DeadLetterQueue) backoff(attempt int) time.Duration {
+	return d.retryDelay << (attempt - 1)
+}
+
+// republishing keeps every property of msg but its headers. Expiration is
+// left out so a message does not expire while it waits for a retry, and
+// UserId because the broker checks it against this connection's user.
+func republishing(msg amqp091.Delivery, headers amqp091.Table) amqp091.Publishing {
+	return amqp091.Publishing{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		AppId:           msg.AppId,
+		Body:            msg.Body,
+	}
+}
+
+func convertDeadLetter(msg amqp091.Delivery) response.DeadLetterResponse {
+	errMsg, _ := msg.Headers[headerError].(string)
+	failedAt, _ := msg.Headers[headerFailedAt].(string)
+	return response.DeadLetterResponse{
+		Body:       string(msg.Body),
+		Error:      errMsg,
+		RetryCount: retryCount(msg.Headers),
+		FailedAt:   failedAt,
+		Headers:    msg.Headers,
+	}
+}
+
+func retryCount(headers amqp091.Table) int {
+	switch count := headers[headerRetryCount].(type) {
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	case int:
+		return count
+	default:
+		return 0
+	}
+}
+
+func copyHeaders(headers amqp091.Table) amqp091.Table {
+	copied := amqp091.Table{}
+	for key, value := range headers {
+		copied[key] = value
+	}
+	return copied
+}
@@ -0,0 +1,58 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func TestDeadLetterQueueBackoff(t *testing.T) {
+	d := NewDeadLetterQueue(config.Config{RabbitMq: &config.RabbitMq{Queue: "julong_notification", RetryDelay: 2}}, logger.NewLogger(), nil)
+
+	for attempt, want := range map[int]time.Duration{1: 2 * time.Second, 2: 4 * time.Second, 3: 8 * time.Second} {
+		if got := d.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+	if queue := d.retryQueue(2); queue != "julong_notification.retry.2" {
+		t.Fatalf("retryQueue(2) = %s", queue)
+	}
+
+	d = NewDeadLetterQueue(config.Config{RabbitMq: &config.RabbitMq{Queue: "julong_notification"}}, logger.NewLogger(), nil)
+	if d.backoff(1) != defaultRetryDelay || d.maxRetries != defaultMaxRetries {
+		t.Fatalf("defaults = %s, %d", d.backoff(1), d.maxRetries)
+	}
+}
+
+func TestRepublishingKeepsProperties(t *testing.T) {
+	msg := amqp091.Delivery{
+		ContentType:   "application/json",
+		DeliveryMode:  amqp091.Persistent,
+		CorrelationId: "correlation",
+		ReplyTo:       "caller",
+		MessageId:     "message",
+		Expiration:    "1000",
+		UserId:        "guest",
+		Headers:       amqp091.Table{apiKeyHeader: "jnk_key"},
+		Body:          []byte(`{}`),
+	}
+
+	headers := copyHeaders(msg.Headers)
+	headers[headerRetryCount] = int32(1)
+	publishing := republishing(msg, headers)
+
+	if publishing.ContentType != msg.ContentType || publishing.DeliveryMode != msg.DeliveryMode ||
+		publishing.CorrelationId != msg.CorrelationId || publishing.ReplyTo != msg.ReplyTo ||
+		publishing.MessageId != msg.MessageId || string(publishing.Body) != string(msg.Body) {
+		t.Fatalf("publishing = %+v", publishing)
+	}
+	if publishing.Headers[apiKeyHeader] != "jnk_key" || publishing.Headers[headerRetryCount] != int32(1) {
+		t.Fatalf("headers = %v", publishing.Headers)
+	}
+	if publishing.Expiration != "" || publishing.UserId != "" {
+		t.Fatalf("expiration %q and user id %q must not be copied", publishing.Expiration, publishing.UserId)
+	}
+}
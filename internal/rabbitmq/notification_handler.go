@@ -0,0 +1,224 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/validator"
+)
+
+// ErrMissingApiKey is replied to messages without an x-api-key header.
+var ErrMissingApiKey = errors.New("x-api-key header is required")
+
+// NotificationMessageHandler exposes INotificationUseCase to sibling services
+// over AMQP. Every message runs as the service its API key was issued to, the
+// same as on the REST API.
+type NotificationMessageHandler struct {
+	log                 logger.Logger
+	validator           validator.Validator
+	notificationUseCase usecase.INotificationUseCase
+	apiKeyUseCase       usecase.IApiKeyUseCase
+}
+
+func NewNotificationMessageHandler(
+	log logger.Logger,
+	validator validator.Validator,
+	notificationUseCase usecase.INotificationUseCase,
+	apiKeyUseCase usecase.IApiKeyUseCase) *NotificationMessageHandler {
+	return &NotificationMessageHandler{
+		log:                 log,
+		validator:           validator,
+		notificationUseCase: notificationUseCase,
+		apiKeyUseCase:       apiKeyUseCase,
+	}
+}
+
+func (h *NotificationMessageHandler) Register(router *Router) {
+	router.Handle("create_notification", h.CreateNotification)
+	router.Handle("mark_notification_read", h.MarkNotificationRead)
+	router.Handle("get_unread_count", h.GetUnreadCount)
+	router.Handle("list_notifications", h.ListNotifications)
+	router.Handle("delete_notifications_by_source", h.DeleteNotificationsBySource)
+	router.Handle("mark_notifications_read_by_source", h.MarkNotificationsReadBySource)
+}
+
+func (h *NotificationMessageHandler) CreateNotification(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+	principal, err := h.principal(docMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request.CreateNotificationRequest{}
+	if err := h.decode(docMsg, req); err != nil {
+		return nil, err
+	}
+
+	res, err := h.notificationUseCase.CreateNotification(ctx, principal, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return successMessageData("Notification created successfully", map[string]interface{}{
+		"ids": res.IDs,
+	}), nil
+}
+
+func (h *NotificationMessageHandler) MarkNotificationRead(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+	principal, err := h.principal(docMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request.MarkNotificationReadRequest{}
+	if err := h.decode(docMsg, req); err != nil {
+		return nil, err
+	}
+
+	notification, err := h.notificationUseCase.MarkNotificationRead(ctx, principal, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return successMessageData("Notification marked as read", map[string]interface{}{
+		"notification": notification,
+	}), nil
+}
+
+func (h *NotificationMessageHandler) GetUnreadCount(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+	principal, err := h.principal(docMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request.GetUnreadCountRequest{}
+	if err := h.decode(docMsg, req); err != nil {
+		return nil, err
+	}
+
+	count, err := h.notificationUseCase.GetUnreadNotificationCount(ctx, principal, req.UserID, req.Application)
+	if err != nil {
+		return nil, err
+	}
+
+	return successMessageData("Unread notification count retrieved successfully", map[string]interface{}{
+		"user_id":      req.UserID,
+		"application":  req.Application,
+		"unread_count": count,
+	}), nil
+}
+
+func (h *NotificationMessageHandler) ListNotifications(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+	principal, err := h.principal(docMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request.ListNotificationsRequest{}
+	if err := h.decode(docMsg, req); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{
+		"user_id": req.UserID,
+	}
+	if req.Application != "" {
+		keys["application"] = req.Application
+	}
+	if req.ReadAt != "" {
+		keys["read_at"] = req.ReadAt
+	}
+	if req.SourceType != "" {
+		keys["source_type"] = req.SourceType
+	}
+	if req.SourceID != "" {
+		keys["source_id"] = req.SourceID
+	}
+
+	page := req.Page
+	if page < 1 {
+		page = 1
+	}
+	pageSize := req.PageSize
+	if pageSize < 1 {
+		pageSize = 10
+	}
+
+	notifications, total, err := h.notificationUseCase.GetNotificationsByKeys(ctx, principal, keys, page, pageSize, req.Search, map[string]interface{}{
+		"created_at": "DESC",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return successMessageData("Notifications retrieved successfully", map[string]interface{}{
+		"notifications": notifications,
+		"total":         total,
+	}), nil
+}
+
+func (h *NotificationMessageHandler) DeleteNotificationsBySource(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+	principal, err := h.principal(docMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request.NotificationSourceRequest{}
+	if err := h.decode(docMsg, req); err != nil {
+		return nil, err
+	}
+
+	deleted, err := h.notificationUseCase.DeleteNotificationsBySource(ctx, principal, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return successMessageData("Notifications deleted successfully", map[string]interface{}{
+		"deleted": deleted,
+	}), nil
+}
+
+func (h *NotificationMessageHandler) MarkNotificationsReadBySource(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+	principal, err := h.principal(docMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &request.NotificationSourceRequest{}
+	if err := h.decode(docMsg, req); err != nil {
+		return nil, err
+	}
+
+	updated, err := h.notificationUseCase.MarkNotificationsReadBySource(ctx, principal, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return successMessageData("Notifications marked as read successfully", map[string]interface{}{
+		"updated": updated,
+	}), nil
+}
+
+// principal authenticates the message by its API key. Missing and unknown
+// keys are rejected, a failed lookup is retried.
+func (h *NotificationMessageHandler) principal(docMsg *request.RabbitMQRequest) (*auth.Principal, error) {
+	if docMsg.ApiKey == "" {
+		return nil, Permanent(ErrMissingApiKey)
+	}
+	principal, err := h.apiKeyUseCase.Authenticate(docMsg.ApiKey)
+	if errors.Is(err, usecase.ErrInvalidApiKey) {
+		h.log.GetLogger().Warn("Rejected AMQP message with an invalid api key ", "message_type", docMsg.MessageType)
+		return nil, Permanent(err)
+	}
+	return principal, err
+}
+
+func (h *NotificationMessageHandler) decode(docMsg *request.RabbitMQRequest, req interface{}) error {
+	if err := decodeMessageData(docMsg.MessageData, req); err != nil {
+		return Permanent(err)
+	}
+	return Permanent(h.validator.GetValidator().Struct(req))
+}
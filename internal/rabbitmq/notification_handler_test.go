@@ -0,0 +1,77 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+)
+
+// fakeApiKeyUseCase knows a single key.
+type fakeApiKeyUseCase struct {
+	key       string
+	principal *auth.Principal
+	err       error
+}
+
+func (f *fakeApiKeyUseCase) CreateApiKey(req *request.CreateApiKeyRequest) (*response.CreateApiKeyResponse, error) {
+	return nil, nil
+}
+
+func (f *fakeApiKeyUseCase) GetAllApiKeys() ([]response.ApiKeyResponse, error) {
+	return nil, nil
+}
+
+func (f *fakeApiKeyUseCase) RevokeApiKey(id string) error {
+	return nil
+}
+
+func (f *fakeApiKeyUseCase) Authenticate(key string) (*auth.Principal, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if key != f.key {
+		return nil, usecase.ErrInvalidApiKey
+	}
+	return f.principal, nil
+}
+
+func TestNotificationMessageHandlerPrincipal(t *testing.T) {
+	service := &auth.Principal{Role: auth.RoleService, Applications: []string{"MANPOWER"}}
+	lookupErr := errors.New("connection refused")
+
+	tests := []struct {
+		name      string
+		apiKey    string
+		err       error
+		want      error
+		permanent bool
+	}{
+		{"valid key", "jnk_valid", nil, nil, false},
+		{"missing key", "", nil, ErrMissingApiKey, true},
+		{"unknown key", "jnk_unknown", nil, usecase.ErrInvalidApiKey, true},
+		{"failed lookup", "jnk_valid", lookupErr, lookupErr, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKeys := &fakeApiKeyUseCase{key: "jnk_valid", principal: service, err: tt.err}
+			h := NewNotificationMessageHandler(logger.NewLogger(), nil, nil, apiKeys)
+
+			principal, err := h.principal(&request.RabbitMQRequest{MessageType: "create_notification", ApiKey: tt.apiKey})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("principal() = %v, want %v", err, tt.want)
+			}
+			if err != nil && isPermanent(err) != tt.permanent {
+				t.Fatalf("isPermanent(%v) = %v", err, !tt.permanent)
+			}
+			if tt.want == nil && principal != service {
+				t.Fatalf("principal = %+v", principal)
+			}
+		})
+	}
+}
@@ -2,83 +2,155 @@ package rabbitmq
 
 import (
 	"encoding/json"
-	"os"
+	"errors"
 
-	"github.com/IlhamSetiaji/julong-notification-be/config"
 	"github.com/IlhamSetiaji/julong-notification-be/logger"
 	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/google/uuid"
 	"github.com/rabbitmq/amqp091-go"
 )
 
-func InitProducer(conf config.Config, log logger.Logger) {
-	// conn
-	conn, err := amqp091.Dial(conf.RabbitMq.Host)
-	if err != nil {
-		log.GetLogger().Printf("ERROR: fail init consumer: %s", err.Error())
-		os.Exit(1)
-	}
+var (
+	ErrUnroutable = errors.New("message is unroutable")
+	ErrNacked     = errors.New("message was rejected by the broker")
+)
+
+// outgoing is a message taken off Pchan or Rchan, kept so that it can be
+// published again after a reconnect if the channel closed before the broker
+// confirmed it.
+type outgoing struct {
+	queueName string
+	body      interface{}
+	result    chan error
+}
+
+// InitProducer publishes Pchan and Rchan messages for the lifetime of the
+// process. While the broker is unreachable messages stay buffered in the
+// channels. Publishes are mandatory and confirmed, and the outcome is
+// reported on the message's Result channel when it has one.
+func InitProducer(log logger.Logger, manager *ConnectionManager) {
+	var pending *outgoing
+	for {
+		conn := manager.Connection()
 
-	log.GetLogger().Printf("INFO: done init producer conn")
+		err := produce(conn, log, &pending)
+		if err != nil {
+			log.GetLogger().Printf("ERROR: producer stopped: %s", err.Error())
+		}
+	}
+}
 
+func produce(conn *amqp091.Connection, log logger.Logger, pending **outgoing) error {
 	// create channel
 	amqpChannel, err := conn.Channel()
 	if err != nil {
-		log.GetLogger().Printf("ERROR: fail create channel: %s", err.Error())
-		os.Exit(1)
+		return err
+	}
+	defer amqpChannel.Close()
+
+	if err := amqpChannel.Confirm(false); err != nil {
+		return err
 	}
 
+	closeChan := amqpChannel.NotifyClose(make(chan *amqp091.Error, 1))
+	returnChan := amqpChannel.NotifyReturn(make(chan amqp091.Return, 16))
+
+	log.GetLogger().Printf("INFO: done init producer")
+
 	for {
-		select {
-		case msg := <-utils.Pchan:
-			// marshal
-			data, err := json.Marshal(&msg.Message)
-			if err != nil {
-				log.GetLogger().Printf("ERROR: fail marshal: %s", err.Error())
-				continue
+		if *pending != nil {
+			err := publish(amqpChannel, returnChan, **pending, log)
+			if err != nil && amqpChannel.IsClosed() {
+				// keep the message for the next channel
+				return err
 			}
+			reportResult(**pending, err)
+			*pending = nil
+		}
 
-			// publish message
-			err = amqpChannel.Publish(
-				"",            // exchange
-				msg.QueueName, // routing key
-				false,         // mandatory
-				false,         // immediate
-				amqp091.Publishing{
-					ContentType: "text/plain",
-					Body:        data,
-				},
-			)
-			if err != nil {
-				log.GetLogger().Printf("ERROR: fail publish msg: %s", err.Error())
-				continue
+		select {
+		case closeErr := <-closeChan:
+			if closeErr != nil {
+				return closeErr
 			}
-
-			log.GetLogger().Printf("INFO: published msg: %v", msg.Message)
+			return amqp091.ErrClosed
+		case msg := <-utils.Pchan:
+			*pending = &outgoing{queueName: msg.QueueName, body: &msg.Message, result: msg.Result}
 		case msg := <-utils.Rchan:
-			// marshal
-			data, err := json.Marshal(&msg.Reply)
-			if err != nil {
-				log.GetLogger().Printf("ERROR: fail marshal: %s", err.Error())
-				continue
-			}
+			*pending = &outgoing{queueName: msg.QueueName, body: &msg.Reply, result: msg.Result}
+		}
+	}
+}
 
-			// publish message
-			err = amqpChannel.Publish(
-				"",            // exchange
-				msg.QueueName, // routing key
-				false,         // mandatory
-				false,         // immediate
-				amqp091.Publishing{
-					ContentType: "text/plain",
-					Body:        data,
-				},
-			)
-			if err != nil {
-				log.GetLogger().Printf("ERROR: fail publish msg: %s", err.Error())
-				continue
-			}
+func publish(amqpChannel *amqp091.Channel, returnChan <-chan amqp091.Return, msg outgoing, log logger.Logger) error {
+	// marshal
+	data, err := json.Marshal(msg.body)
+	if err != nil {
+		log.GetLogger().Printf("ERROR: fail marshal: %s", err.Error())
+		return err
+	}
+
+	messageID := uuid.New().String()
+
+	// publish message
+	confirmation, err := amqpChannel.PublishWithDeferredConfirm(
+		"",            // exchange
+		msg.queueName, // routing key
+		true,          // mandatory
+		false,         // immediate
+		amqp091.Publishing{
+			ContentType: "text/plain",
+			MessageId:   messageID,
+			Body:        data,
+		},
+	)
+	if err != nil {
+		log.GetLogger().Printf("ERROR: fail publish msg: %s", err.Error())
+		return err
+	}
+
+	acked := confirmation.Wait()
 
-			log.GetLogger().Printf("INFO: published msg: %v to: %s", msg.Reply, msg.QueueName)
+	if ret := drainReturns(returnChan, messageID); ret != nil {
+		log.GetLogger().Printf("ERROR: unroutable msg to: %s: %s", msg.queueName, ret.ReplyText)
+		return ErrUnroutable
+	}
+
+	if !acked {
+		if amqpChannel.IsClosed() {
+			return amqp091.ErrClosed
 		}
+		log.GetLogger().Printf("ERROR: msg nacked: %s", data)
+		return ErrNacked
+	}
+
+	log.GetLogger().Printf("INFO: published msg: %s to: %s", data, msg.queueName)
+	return nil
+}
+
+// drainReturns empties returnChan and reports the return for messageID, if
+// any. The broker sends basic.return before the ack of an unroutable message,
+// so it is already buffered once the confirmation arrived.
+func drainReturns(returnChan <-chan amqp091.Return, messageID string) *amqp091.Return {
+	var found *amqp091.Return
+	for {
+		select {
+		case ret := <-returnChan:
+			if ret.MessageId == messageID {
+				found = &ret
+			}
+		default:
+			return found
+		}
+	}
+}
+
+func reportResult(msg outgoing, err error) {
+	if msg.result == nil {
+		return
+	}
+	select {
+	case msg.result <- err:
+	default:
 	}
 }
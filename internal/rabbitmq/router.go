@@ -0,0 +1,170 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+)
+
+// MessageHandler handles one message type. The returned data is sent back to
+// reply_to; returning nil data and a nil error sends no reply at all. ctx is
+// cancelled when the consumer that received the message stops.
+type MessageHandler func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error)
+
+// defaultReplyTimeout bounds how long Dispatch waits for the publisher to take
+// a reply while the broker is disconnected.
+const defaultReplyTimeout = 5 * time.Second
+
+// Router dispatches consumed messages to the handler registered for their
+// message_type.
+type Router struct {
+	log          logger.Logger
+	handlers     map[string]MessageHandler
+	replyTimeout time.Duration
+	mu           sync.RWMutex
+}
+
+func NewRouter(log logger.Logger) *Router {
+	return &Router{
+		log:          log,
+		handlers:     make(map[string]MessageHandler),
+		replyTimeout: defaultReplyTimeout,
+	}
+}
+
+func (r *Router) Handle(messageType string, handler MessageHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[messageType] = handler
+}
+
+// Dispatch runs the handler for docMsg and replies to reply_to. Permanent
+// handler errors, such as a message that does not validate, are part of the
+// reply. Any other error, a panic, or a reply the publisher does not take in
+// time is returned so that the delivery is retried and eventually
+// dead-lettered.
+func (r *Router) Dispatch(ctx context.Context, docMsg *request.RabbitMQRequest) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic handling %s: %v", docMsg.MessageType, rec)
+		}
+	}()
+
+	r.mu.RLock()
+	handler, ok := r.handlers[docMsg.MessageType]
+	r.mu.RUnlock()
+
+	var msgData map[string]interface{}
+	if !ok {
+		r.log.GetLogger().Printf("Unknown message type, please recheck your type: %s", docMsg.MessageType)
+		msgData = errorMessageData(errors.New("unknown message type"))
+	} else {
+		data, err := handler(ctx, docMsg)
+		if err != nil {
+			if !isPermanent(err) {
+				return fmt.Errorf("handle %s: %w", docMsg.MessageType, err)
+			}
+			r.log.GetLogger().Printf("ERROR: fail handle %s: %s", docMsg.MessageType, err.Error())
+			msgData = errorMessageData(err)
+		} else if data == nil {
+			return nil
+		} else {
+			msgData = data
+		}
+	}
+
+	if docMsg.ReplyTo == "" {
+		return nil
+	}
+
+	// reply
+	reply := response.RabbitMQResponse{
+		ID:          docMsg.ID,
+		MessageType: "reply",
+		MessageData: msgData,
+	}
+	msg := utils.RabbitMsgConsumer{
+		QueueName: docMsg.ReplyTo,
+		Reply:     reply,
+	}
+	timer := time.NewTimer(r.replyTimeout)
+	defer timer.Stop()
+	select {
+	case utils.Rchan <- msg:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("reply to %s: %w", docMsg.ReplyTo, ctx.Err())
+	case <-timer.C:
+		return fmt.Errorf("reply to %s: publisher did not take the reply within %s", docMsg.ReplyTo, r.replyTimeout)
+	}
+}
+
+// permanentError marks a handler error that would fail again on redelivery.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not worth retrying; it is replied to the caller and
+// the message is acked.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent also treats the use case's authorization and input errors as
+// permanent, everything else is assumed to be transient, e.g. a lost database
+// connection.
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent) ||
+		errors.Is(err, auth.ErrForbidden) ||
+		errors.Is(err, auth.ErrNotFound) ||
+		errors.Is(err, usecase.ErrValidation)
+}
+
+// decodeMessageData maps the loosely typed message_data onto a request struct.
+func decodeMessageData(data map[string]interface{}, target interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
+func successMessageData(message string, data map[string]interface{}) map[string]interface{} {
+	msgData := map[string]interface{}{
+		"status":  "success",
+		"message": message,
+	}
+	for key, value := range data {
+		msgData[key] = value
+	}
+	return msgData
+}
+
+func errorMessageData(err error) map[string]interface{} {
+	return map[string]interface{}{
+		"status": "error",
+		"error":  err.Error(),
+	}
+}
@@ -0,0 +1,181 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+)
+
+func receiveReply(t *testing.T) utils.RabbitMsgConsumer {
+	t.Helper()
+	select {
+	case msg := <-utils.Rchan:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no reply published")
+		return utils.RabbitMsgConsumer{}
+	}
+}
+
+func expectNoReply(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-utils.Rchan:
+		t.Fatalf("unexpected reply %+v", msg)
+	default:
+	}
+}
+
+func TestRouterDispatchRepliesWithHandlerData(t *testing.T) {
+	router := NewRouter(logger.NewLogger())
+	router.Handle("ping", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		return map[string]interface{}{"pong": docMsg.MessageData["value"]}, nil
+	})
+
+	err := router.Dispatch(context.Background(), &request.RabbitMQRequest{
+		ID:          "1",
+		MessageType: "ping",
+		MessageData: map[string]interface{}{"value": "hello"},
+		ReplyTo:     "caller",
+	})
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+
+	msg := receiveReply(t)
+	if msg.QueueName != "caller" || msg.Reply.ID != "1" || msg.Reply.MessageType != "reply" {
+		t.Fatalf("reply = %+v", msg)
+	}
+	if msg.Reply.MessageData["pong"] != "hello" {
+		t.Fatalf("message_data = %v", msg.Reply.MessageData)
+	}
+}
+
+func TestRouterDispatchUnknownMessageType(t *testing.T) {
+	router := NewRouter(logger.NewLogger())
+
+	if err := router.Dispatch(context.Background(), &request.RabbitMQRequest{ID: "2", MessageType: "nope", ReplyTo: "caller"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+
+	msg := receiveReply(t)
+	if msg.Reply.MessageData["status"] != "error" {
+		t.Fatalf("message_data = %v", msg.Reply.MessageData)
+	}
+}
+
+func TestRouterDispatchPermanentError(t *testing.T) {
+	router := NewRouter(logger.NewLogger())
+	router.Handle("invalid", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		return nil, Permanent(errors.New("boom"))
+	})
+	router.Handle("forbidden", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		return nil, auth.ErrForbidden
+	})
+
+	if err := router.Dispatch(context.Background(), &request.RabbitMQRequest{ID: "3", MessageType: "invalid", ReplyTo: "caller"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if msg := receiveReply(t); msg.Reply.MessageData["error"] != "boom" {
+		t.Fatalf("message_data = %v", msg.Reply.MessageData)
+	}
+
+	if err := router.Dispatch(context.Background(), &request.RabbitMQRequest{ID: "4", MessageType: "forbidden", ReplyTo: "caller"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if msg := receiveReply(t); msg.Reply.MessageData["error"] != auth.ErrForbidden.Error() {
+		t.Fatalf("message_data = %v", msg.Reply.MessageData)
+	}
+	router.Handle("empty", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		return nil, usecase.NewValidationError("user_ids cannot be empty")
+	})
+	if err := router.Dispatch(context.Background(), &request.RabbitMQRequest{ID: "5", MessageType: "empty", ReplyTo: "caller"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if msg := receiveReply(t); msg.Reply.MessageData["error"] != "user_ids cannot be empty" {
+		t.Fatalf("message_data = %v", msg.Reply.MessageData)
+	}
+}
+
+func TestRouterDispatchTransientErrorIsRetried(t *testing.T) {
+	router := NewRouter(logger.NewLogger())
+	cause := errors.New("connection refused")
+	router.Handle("create", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		return nil, cause
+	})
+
+	err := router.Dispatch(context.Background(), &request.RabbitMQRequest{ID: "5", MessageType: "create", ReplyTo: "caller"})
+	if !errors.Is(err, cause) {
+		t.Fatalf("Dispatch() = %v, want the handler error", err)
+	}
+	// the caller gets its reply from the retried delivery
+	expectNoReply(t)
+}
+
+func TestRouterDispatchWithoutReply(t *testing.T) {
+	router := NewRouter(logger.NewLogger())
+	router.Handle("event", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		return nil, nil
+	})
+	router.Handle("command", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		return map[string]interface{}{"status": "success"}, nil
+	})
+
+	// nil data sends nothing, even with reply_to set
+	if err := router.Dispatch(context.Background(), &request.RabbitMQRequest{ID: "6", MessageType: "event", ReplyTo: "caller"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	// nobody to reply to
+	if err := router.Dispatch(context.Background(), &request.RabbitMQRequest{ID: "7", MessageType: "command"}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	expectNoReply(t)
+}
+
+func TestRouterDispatchRecoversPanics(t *testing.T) {
+	router := NewRouter(logger.NewLogger())
+	router.Handle("panic", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		panic("handler bug")
+	})
+
+	if err := router.Dispatch(context.Background(), &request.RabbitMQRequest{ID: "8", MessageType: "panic", ReplyTo: "caller"}); err == nil {
+		t.Fatal("expected an error so the delivery is retried")
+	}
+	expectNoReply(t)
+}
+
+func TestRouterDispatchGivesUpOnBlockedReply(t *testing.T) {
+	router := NewRouter(logger.NewLogger())
+	router.replyTimeout = 50 * time.Millisecond
+	router.Handle("ping", func(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+		return map[string]interface{}{"pong": true}, nil
+	})
+
+	// the publisher is disconnected and its queue is full
+	for len(utils.Rchan) < cap(utils.Rchan) {
+		utils.Rchan <- utils.RabbitMsgConsumer{}
+	}
+	defer func() {
+		for len(utils.Rchan) > 0 {
+			<-utils.Rchan
+		}
+	}()
+
+	docMsg := &request.RabbitMQRequest{ID: "1", MessageType: "ping", ReplyTo: "caller"}
+	if err := router.Dispatch(context.Background(), docMsg); err == nil {
+		t.Fatal("Dispatch() = nil, want the reply timeout")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := router.Dispatch(ctx, docMsg); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Dispatch() = %v, want canceled", err)
+	}
+}
@@ -0,0 +1,41 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/messaging"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+)
+
+// UserEventHandler keeps the user cache in sync with events published by the
+// SSO service.
+type UserEventHandler struct {
+	log       logger.Logger
+	userCache messaging.IUserCache
+}
+
+func NewUserEventHandler(log logger.Logger, userCache messaging.IUserCache) *UserEventHandler {
+	return &UserEventHandler{
+		log:       log,
+		userCache: userCache,
+	}
+}
+
+func (h *UserEventHandler) Register(router *Router) {
+	router.Handle("user_updated", h.UserUpdated)
+}
+
+func (h *UserEventHandler) UserUpdated(ctx context.Context, docMsg *request.RabbitMQRequest) (map[string]interface{}, error) {
+	userID, ok := docMsg.MessageData["user_id"].(string)
+	if !ok || userID == "" {
+		return nil, Permanent(errors.New("user_id is required"))
+	}
+
+	h.userCache.Invalidate(userID)
+	h.log.GetLogger().Printf("INFO: invalidated cached user: %s", userID)
+
+	// events are fire-and-forget
+	return nil, nil
+}
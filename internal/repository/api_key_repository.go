@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/IlhamSetiaji/julong-notification-be/database"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"gorm.io/gorm"
+)
+
+type IApiKeyRepository interface {
+	CreateApiKey(ent *entity.ApiKey) (*entity.ApiKey, error)
+	GetAllApiKeys() ([]entity.ApiKey, error)
+	FindByKeys(keys map[string]interface{}) (*entity.ApiKey, error)
+	UpdateApiKey(ent *entity.ApiKey) (*entity.ApiKey, error)
+}
+
+type ApiKeyRepository struct {
+	db  database.Database
+	log logger.Logger
+}
+
+func NewApiKeyRepository(db database.Database, log logger.Logger) IApiKeyRepository {
+	return &ApiKeyRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+func (r *ApiKeyRepository) CreateApiKey(ent *entity.ApiKey) (*entity.ApiKey, error) {
+	err := r.db.GetDb().Create(ent).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to create api key: ", "error", err)
+		return nil, err
+	}
+	return ent, nil
+}
+
+func (r *ApiKeyRepository) GetAllApiKeys() ([]entity.ApiKey, error) {
+	ent := []entity.ApiKey{}
+	err := r.db.GetDb().Order("created_at DESC").Find(&ent).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to get all api keys: ", "error", err)
+		return nil, err
+	}
+	return ent, nil
+}
+
+func (r *ApiKeyRepository) FindByKeys(keys map[string]interface{}) (*entity.ApiKey, error) {
+	ent := &entity.ApiKey{}
+	err := r.db.GetDb().Where(keys).First(ent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil // Not found is not an error
+		}
+		r.log.GetLogger().Error("Failed to find api key by keys: ", "error", err)
+		return nil, err
+	}
+
+	return ent, nil
+}
+
+func (r *ApiKeyRepository) UpdateApiKey(ent *entity.ApiKey) (*entity.ApiKey, error) {
+	err := r.db.GetDb().Where("id = ?", ent.ID).Updates(ent).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to update api key: ", "error", err)
+		return nil, err
+	}
+	return ent, nil
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/database"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type IIdempotencyKeyRepository interface {
+	FindByKeys(keys map[string]interface{}) (*entity.IdempotencyKey, error)
+	DeleteIdempotencyKey(id uuid.UUID) error
+	DeleteExpiredIdempotencyKeys(now time.Time) (int64, error)
+}
+
+type IdempotencyKeyRepository struct {
+	db  database.Database
+	log logger.Logger
+}
+
+func NewIdempotencyKeyRepository(db database.Database, log logger.Logger) IIdempotencyKeyRepository {
+	return &IdempotencyKeyRepository{
+		db:  db,
+		log: log,
+	}
+}
+
+func (r *IdempotencyKeyRepository) FindByKeys(keys map[string]interface{}) (*entity.IdempotencyKey, error) {
+	ent := &entity.IdempotencyKey{}
+	err := r.db.GetDb().Where(keys).First(ent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil // Not found is not an error
+		}
+		r.log.GetLogger().Error("Failed to find idempotency key by keys: ", "error", err)
+		return nil, err
+	}
+
+	return ent, nil
+}
+
+// DeleteIdempotencyKey removes the row for good, otherwise the unique index
+// would keep blocking the key after it expired.
+func (r *IdempotencyKeyRepository) DeleteIdempotencyKey(id uuid.UUID) error {
+	err := r.db.GetDb().Unscoped().Where("id = ?", id).Delete(&entity.IdempotencyKey{}).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to delete idempotency key: ", "error", err)
+		return err
+	}
+	return nil
+}
+
+func (r *IdempotencyKeyRepository) DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	result := r.db.GetDb().Unscoped().Where("expires_at < ?", now).Delete(&entity.IdempotencyKey{})
+	if result.Error != nil {
+		r.log.GetLogger().Error("Failed to delete expired idempotency keys: ", "error", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
@@ -2,25 +2,43 @@ package repository
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/IlhamSetiaji/julong-notification-be/database"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
 	"github.com/IlhamSetiaji/julong-notification-be/logger"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type INotificationRepository interface {
 	CreateNotification(ent *entity.Notification) (*entity.Notification, error)
+	CreateNotifications(ents []entity.Notification, idempotencyKey *entity.IdempotencyKey) error
 	GetNotificationsByKeys(keys map[string]interface{}) ([]entity.Notification, error)
 	GetNotificationsByKeysPagination(keys map[string]interface{}, page, pageSize int, search string, sort map[string]interface{}) ([]entity.Notification, int64, error)
 	GetAllNotifications() ([]entity.Notification, error)
 	FindByKeys(keys map[string]interface{}) (*entity.Notification, error)
+	FindByKeysIncludingDeleted(keys map[string]interface{}) (*entity.Notification, error)
 	UpdateNotification(ent *entity.Notification) (*entity.Notification, error)
 	DeleteNotification(id uuid.UUID) error
+	DeleteNotificationsByKeys(keys map[string]interface{}) ([]entity.Notification, error)
+	UpdateNotificationsReadAt(keys map[string]interface{}, ids []uuid.UUID, before *time.Time, readAt *time.Time) ([]entity.Notification, error)
 	GetUnreadNotificationCount(userID uuid.UUID, application string) (int64, error)
+	GetUnreadNotificationCounts(userIDs []uuid.UUID, application string) (map[uuid.UUID]int64, error)
+	GetUnreadNotificationCountsByApplication(userID uuid.UUID, applications []string) (map[string]int64, error)
+	GetNotificationsCreatedAfter(keys map[string]interface{}, after time.Time, afterID uuid.UUID, limit int) ([]entity.Notification, error)
+	GetNotificationsWithoutUserNames(afterID uuid.UUID, limit int) ([]entity.Notification, error)
+	UpdateUserNames(id uuid.UUID, userName string, createdByName string) error
 }
 
+const createBatchSize = 100
+
+// notificationOwnerReturning is enough to recompute unread counts after a
+// bulk statement.
+var notificationOwnerReturning = clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "user_id"}, {Name: "application"}}}
+
 type NotificationRepository struct {
 	db  database.Database
 	log logger.Logger
@@ -42,6 +60,33 @@ func (r *NotificationRepository) CreateNotification(ent *entity.Notification) (*
 	return ent, nil
 }
 
+// CreateNotifications inserts ents in batches inside a single transaction, so
+// either every recipient gets the notification or none does. When
+// idempotencyKey is set it is stored in the same transaction with the created
+// IDs, and a concurrent request with the same key fails on its unique index.
+func (r *NotificationRepository) CreateNotifications(ents []entity.Notification, idempotencyKey *entity.IdempotencyKey) error {
+	err := r.db.GetDb().Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(ents, createBatchSize).Error; err != nil {
+			return err
+		}
+		if idempotencyKey == nil {
+			return nil
+		}
+
+		ids := make([]string, 0, len(ents))
+		for _, ent := range ents {
+			ids = append(ids, ent.ID.String())
+		}
+		idempotencyKey.NotificationIDs = strings.Join(ids, ",")
+		return tx.Create(idempotencyKey).Error
+	})
+	if err != nil {
+		r.log.GetLogger().Error("Failed to create notifications: ", "error", err)
+		return err
+	}
+	return nil
+}
+
 func (r *NotificationRepository) GetNotificationsByKeys(keys map[string]interface{}) ([]entity.Notification, error) {
 	ent := []entity.Notification{}
 	if keys["read_at"] != nil {
@@ -78,7 +123,22 @@ func (r *NotificationRepository) GetNotificationsByKeys(keys map[string]interfac
 func (r *NotificationRepository) GetNotificationsByKeysPagination(keys map[string]interface{}, page, pageSize int, search string, sort map[string]interface{}) ([]entity.Notification, int64, error) {
 	ent := []entity.Notification{}
 	count := int64(0)
-	query := r.db.GetDb().Model(&entity.Notification{}).Where(keys)
+	query := r.db.GetDb().Model(&entity.Notification{})
+
+	if readAt, ok := keys["read_at"]; ok {
+		delete(keys, "read_at")
+		switch readAt {
+		case "YES":
+			query = query.Where("read_at IS NOT NULL")
+		case "NO":
+			query = query.Where("read_at IS NULL")
+		default:
+			r.log.GetLogger().Error("Invalid value for read_at key: ", "value", readAt)
+			return nil, 0, errors.New("invalid value for read_at key")
+		}
+	}
+
+	query = query.Where(keys)
 
 	if search != "" {
 		query = query.Where("name ILIKE ? OR message ILIKE ?", "%"+search+"%", "%"+search+"%")
@@ -129,6 +189,22 @@ func (r *NotificationRepository) FindByKeys(keys map[string]interface{}) (*entit
 	return ent, nil
 }
 
+// FindByKeysIncludingDeleted also finds soft-deleted notifications, e.g. the
+// last notification a reconnecting socket saw before it was retracted.
+func (r *NotificationRepository) FindByKeysIncludingDeleted(keys map[string]interface{}) (*entity.Notification, error) {
+	ent := &entity.Notification{}
+	err := r.db.GetDb().Unscoped().Where(keys).First(ent).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil // Not found is not an error
+		}
+		r.log.GetLogger().Error("Failed to find notification including deleted by keys: ", "error", err)
+		return nil, err
+	}
+
+	return ent, nil
+}
+
 func (r *NotificationRepository) UpdateNotification(ent *entity.Notification) (*entity.Notification, error) {
 	err := r.db.GetDb().Where("id = ?", ent.ID).Updates(ent).Error
 	if err != nil {
@@ -147,6 +223,84 @@ func (r *NotificationRepository) DeleteNotification(id uuid.UUID) error {
 	return nil
 }
 
+// DeleteNotificationsByKeys deletes the matching notifications and returns the
+// id, user_id and application of every deleted row.
+func (r *NotificationRepository) DeleteNotificationsByKeys(keys map[string]interface{}) ([]entity.Notification, error) {
+	ent := []entity.Notification{}
+	err := r.db.GetDb().
+		Clauses(notificationOwnerReturning).
+		Where(keys).
+		Delete(&ent).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to delete notifications by keys: ", "error", err)
+		return nil, err
+	}
+	return ent, nil
+}
+
+// GetUnreadNotificationCountsByApplication counts the user's unread
+// notifications per application with one grouped query. Every requested
+// application is present in the result; an empty list counts all of them.
+func (r *NotificationRepository) GetUnreadNotificationCountsByApplication(userID uuid.UUID, applications []string) (map[string]int64, error) {
+	var rows []struct {
+		Application string
+		Count       int64
+	}
+	query := r.db.GetDb().Model(&entity.Notification{}).
+		Select("application, COUNT(*) AS count").
+		Where("user_id = ? AND read_at IS NULL", userID)
+	if len(applications) > 0 {
+		query = query.Where("application IN ?", applications)
+	}
+	err := query.Group("application").Scan(&rows).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to get unread notification counts by application: ", "error", err)
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(applications))
+	for _, application := range applications {
+		counts[application] = 0
+	}
+	for _, row := range rows {
+		counts[row.Application] = row.Count
+	}
+	return counts, nil
+}
+
+// UpdateNotificationsReadAt sets read_at on the matching notifications in one
+// UPDATE, or clears it when readAt is nil. Only rows whose state changes are
+// touched, and their id, user_id and application are returned.
+func (r *NotificationRepository) UpdateNotificationsReadAt(keys map[string]interface{}, ids []uuid.UUID, before *time.Time, readAt *time.Time) ([]entity.Notification, error) {
+	ent := []entity.Notification{}
+	query := r.db.GetDb().Model(&ent).Clauses(notificationOwnerReturning)
+
+	if len(keys) > 0 {
+		query = query.Where(keys)
+	}
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+	if before != nil {
+		query = query.Where("created_at < ?", *before)
+	}
+	if readAt != nil {
+		query = query.Where("read_at IS NULL")
+	} else {
+		query = query.Where("read_at IS NOT NULL")
+	}
+
+	err := query.Updates(map[string]interface{}{
+		"read_at":    readAt,
+		"updated_at": time.Now(),
+	}).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to update notifications read_at: ", "error", err)
+		return nil, err
+	}
+	return ent, nil
+}
+
 func (r *NotificationRepository) GetUnreadNotificationCount(userID uuid.UUID, application string) (int64, error) {
 	ent := int64(0)
 	err := r.db.GetDb().Model(&entity.Notification{}).
@@ -158,3 +312,80 @@ func (r *NotificationRepository) GetUnreadNotificationCount(userID uuid.UUID, ap
 	}
 	return ent, nil
 }
+
+// GetUnreadNotificationCounts counts the unread notifications of every user in
+// userIDs with one grouped query. Users without unread notifications map to 0.
+func (r *NotificationRepository) GetUnreadNotificationCounts(userIDs []uuid.UUID, application string) (map[uuid.UUID]int64, error) {
+	var rows []struct {
+		UserID uuid.UUID
+		Count  int64
+	}
+	err := r.db.GetDb().Model(&entity.Notification{}).
+		Select("user_id, COUNT(*) AS count").
+		Where("user_id IN ? AND application = ? AND read_at IS NULL", userIDs, application).
+		Group("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to get unread notification counts: ", "error", err)
+		return nil, err
+	}
+
+	counts := make(map[uuid.UUID]int64, len(userIDs))
+	for _, userID := range userIDs {
+		counts[userID] = 0
+	}
+	for _, row := range rows {
+		counts[row.UserID] = row.Count
+	}
+	return counts, nil
+}
+
+// GetNotificationsCreatedAfter returns the notifications matching keys that
+// were created after the cursor, oldest first. afterID breaks ties between
+// notifications created at the same instant; pass uuid.Nil to ignore it.
+func (r *NotificationRepository) GetNotificationsCreatedAfter(keys map[string]interface{}, after time.Time, afterID uuid.UUID, limit int) ([]entity.Notification, error) {
+	ent := []entity.Notification{}
+	query := r.db.GetDb().Where(keys)
+	if afterID != uuid.Nil {
+		query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", after, after, afterID)
+	} else {
+		query = query.Where("created_at > ?", after)
+	}
+
+	err := query.Order("created_at ASC, id ASC").Limit(limit).Find(&ent).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to get notifications created after cursor: ", "error", err)
+		return nil, err
+	}
+	return ent, nil
+}
+
+// GetNotificationsWithoutUserNames pages through notifications missing a
+// stored recipient or sender name, ordered by ID so afterID can be the cursor.
+func (r *NotificationRepository) GetNotificationsWithoutUserNames(afterID uuid.UUID, limit int) ([]entity.Notification, error) {
+	ent := []entity.Notification{}
+	err := r.db.GetDb().
+		Where("(user_name = '' OR created_by_name = '') AND id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&ent).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to get notifications without user names: ", "error", err)
+		return nil, err
+	}
+	return ent, nil
+}
+
+func (r *NotificationRepository) UpdateUserNames(id uuid.UUID, userName string, createdByName string) error {
+	err := r.db.GetDb().Model(&entity.Notification{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"user_name":       userName,
+			"created_by_name": createdByName,
+		}).Error
+	if err != nil {
+		r.log.GetLogger().Error("Failed to update user names: ", "error", err)
+		return err
+	}
+	return nil
+}
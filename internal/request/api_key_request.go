@@ -0,0 +1,7 @@
+package request
+
+type CreateApiKeyRequest struct {
+	Name             string   `json:"name" validate:"required"`
+	Applications     []string `json:"applications" validate:"required,min=1,dive,application"`
+	AllowedCreatedBy []string `json:"allowed_created_by" validate:"omitempty,dive,uuid"`
+}
@@ -1,12 +1,15 @@
 package request
 
 type CreateNotificationRequest struct {
-	Application string   `json:"application" validate:"required,application"`
-	Name        string   `json:"name" validate:"required"`
-	URL         string   `json:"url" validate:"required"`
-	Message     string   `json:"message" validate:"required"`
-	UserIDs     []string `json:"user_ids" validate:"required,dive"`
-	CreatedBy   string   `json:"created_by" validate:"required,uuid"`
+	Application    string   `json:"application" validate:"required,application"`
+	Name           string   `json:"name" validate:"required"`
+	URL            string   `json:"url" validate:"required"`
+	Message        string   `json:"message" validate:"required"`
+	UserIDs        []string `json:"user_ids" validate:"required,min=1,dive,uuid"`
+	CreatedBy      string   `json:"created_by" validate:"required,uuid"`
+	SourceType     string   `json:"source_type" validate:"required_with=SourceID,max=100"`
+	SourceID       string   `json:"source_id" validate:"required_with=SourceType,max=255"`
+	IdempotencyKey string   `json:"idempotency_key" validate:"omitempty,max=255"` // may also be sent as the Idempotency-Key header
 }
 
 type UpdateNotificationRequest struct {
@@ -18,3 +21,55 @@ type UpdateNotificationRequest struct {
 	ReadAt      *string `json:"read_at" validate:"omitempty"`
 	CreatedBy   string  `json:"created_by" validate:"omitempty,uuid"`
 }
+
+type MarkNotificationReadRequest struct {
+	ID string `json:"id" validate:"required,uuid"`
+}
+
+type GetUnreadCountRequest struct {
+	UserID      string `json:"user_id" validate:"required,uuid"`
+	Application string `json:"application" validate:"required,application"`
+}
+
+type ListNotificationsRequest struct {
+	UserID      string `json:"user_id" validate:"required,uuid"`
+	Application string `json:"application" validate:"omitempty,application"`
+	ReadAt      string `json:"read_at" validate:"omitempty,oneof=YES NO"`
+	Page        int    `json:"page" validate:"omitempty,min=1"`
+	PageSize    int    `json:"page_size" validate:"omitempty,min=1,max=100"`
+	Search      string `json:"search" validate:"omitempty"`
+	SourceType  string `json:"source_type" validate:"omitempty"`
+	SourceID    string `json:"source_id" validate:"omitempty"`
+}
+
+// NotificationSourceRequest identifies the notifications raised for one
+// business object, either by source_type and source_id or by their URL.
+type NotificationSourceRequest struct {
+	Application string `json:"application" validate:"required,application"`
+	SourceType  string `json:"source_type" validate:"required_with=SourceID"`
+	SourceID    string `json:"source_id" validate:"required_with=SourceType"`
+	URL         string `json:"url" validate:"required_without=SourceID"`
+}
+
+// MarkNotificationsRequest selects the caller's notifications either by IDs or
+// by a filter. An empty request marks every notification of the caller.
+type MarkNotificationsRequest struct {
+	IDs         []string `json:"ids" validate:"omitempty,dive,uuid"`
+	Application string   `json:"application" validate:"omitempty,application"`
+	Before      string   `json:"before" validate:"omitempty"` // RFC3339, only notifications created before it
+	SourceType  string   `json:"source_type" validate:"required_with=SourceID"`
+	SourceID    string   `json:"source_id" validate:"required_with=SourceType"`
+	Unread      bool     `json:"unread"` // mark as unread instead of read
+}
+
+// ReplayNotificationsRequest is the cursor a reconnecting socket resumes from.
+// LastEventID is the ID of the last notification_created event, which is the
+// notification ID; other events cannot be resumed from. It takes precedence
+// over Since, which is used when LastEventID does not resolve, so clients
+// should send the ts of the last event they saw as well.
+type ReplayNotificationsRequest struct {
+	UserID       string   `validate:"required,uuid"`
+	Applications []string `validate:"omitempty,dive,application"` // empty replays every application
+	Since        string   `validate:"omitempty"`                  // RFC3339
+	LastEventID  string   `validate:"omitempty,uuid"`
+}
@@ -5,4 +5,5 @@ type RabbitMQRequest struct {
 	MessageType string                 `json:"message_type"`
 	MessageData map[string]interface{} `json:"message_data"`
 	ReplyTo     string                 `json:"reply_to"`
+	ApiKey      string                 `json:"-"` // from the x-api-key header, never from the body
 }
@@ -3,3 +3,7 @@ package request
 type SendFindUserByIDMessageRequest struct {
 	ID string `json:"id"`
 }
+
+type SendFindUsersByIDsMessageRequest struct {
+	IDs []string `json:"ids"`
+}
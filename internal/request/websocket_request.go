@@ -0,0 +1,11 @@
+package request
+
+type SubscriptionRequest struct {
+	Application string `json:"application" validate:"required,application"`
+}
+
+// SetSubscriptionsRequest replaces the applications a socket is subscribed
+// to. An empty list subscribes to every application.
+type SetSubscriptionsRequest struct {
+	Applications []string `json:"applications" validate:"omitempty,dive,application"`
+}
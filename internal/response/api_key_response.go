@@ -0,0 +1,24 @@
+package response
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ApiKeyResponse struct {
+	ID               uuid.UUID  `json:"id"`
+	Name             string     `json:"name"`
+	Prefix           string     `json:"prefix"`
+	Applications     []string   `json:"applications"`
+	AllowedCreatedBy []string   `json:"allowed_created_by"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// CreateApiKeyResponse carries the plaintext key, which is only ever shown once.
+type CreateApiKeyResponse struct {
+	ApiKeyResponse
+	Key string `json:"key"`
+}
@@ -0,0 +1,9 @@
+package response
+
+type DeadLetterResponse struct {
+	Body       string                 `json:"body"`
+	Error      string                 `json:"error"`
+	RetryCount int                    `json:"retry_count"`
+	FailedAt   string                 `json:"failed_at"`
+	Headers    map[string]interface{} `json:"headers"`
+}
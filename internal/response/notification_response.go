@@ -17,6 +17,12 @@ type NotificationResponse struct {
 	CreatedBy     uuid.UUID  `json:"created_by"`
 	UserName      string     `json:"user_name"`
 	CreatedByName string     `json:"created_by_name"`
+	SourceType    string     `json:"source_type"`
+	SourceID      string     `json:"source_id"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
 }
+
+type CreateNotificationResponse struct {
+	IDs []uuid.UUID `json:"ids"`
+}
@@ -5,6 +5,11 @@ type SendFindUserByIDResponse struct {
 	Name string `json:"name"`
 }
 
+// SendFindUsersByIDsResponse only lists the users the SSO could resolve.
+type SendFindUsersByIDsResponse struct {
+	Users []SendFindUserByIDResponse `json:"users"`
+}
+
 type SendGetUserMeResponse struct {
 	User map[string]interface{} `json:"user"`
 }
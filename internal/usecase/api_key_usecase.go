@@ -0,0 +1,164 @@
+package usecase
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/dto"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/repository"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/IlhamSetiaji/julong-notification-be/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	apiKeyPrefix       = "jnk_"
+	apiKeyRandomLength = 40
+	apiKeyDisplayChars = 12
+)
+
+var (
+	ErrInvalidApiKey   = errors.New("invalid api key")
+	ErrInvalidApiKeyID = NewValidationError("invalid api key ID format")
+	ErrApiKeyNotFound  = errors.New("api key not found")
+)
+
+type IApiKeyUseCase interface {
+	CreateApiKey(req *request.CreateApiKeyRequest) (*response.CreateApiKeyResponse, error)
+	GetAllApiKeys() ([]response.ApiKeyResponse, error)
+	RevokeApiKey(id string) error
+	Authenticate(key string) (*auth.Principal, error)
+}
+
+type ApiKeyUseCase struct {
+	log              logger.Logger
+	apiKeyDTO        dto.IApiKeyDTO
+	apiKeyRepository repository.IApiKeyRepository
+}
+
+func NewApiKeyUseCase(
+	log logger.Logger,
+	apiKeyDTO dto.IApiKeyDTO,
+	apiKeyRepository repository.IApiKeyRepository) IApiKeyUseCase {
+	return &ApiKeyUseCase{
+		log:              log,
+		apiKeyDTO:        apiKeyDTO,
+		apiKeyRepository: apiKeyRepository,
+	}
+}
+
+func (uc *ApiKeyUseCase) CreateApiKey(req *request.CreateApiKeyRequest) (*response.CreateApiKeyResponse, error) {
+	for _, createdBy := range req.AllowedCreatedBy {
+		if _, err := uuid.Parse(createdBy); err != nil {
+			return nil, errors.New("invalid allowed_created_by format")
+		}
+	}
+
+	key := apiKeyPrefix + utils.GenerateRandomStringToken(apiKeyRandomLength)
+
+	apiKey := &entity.ApiKey{
+		Name:             req.Name,
+		Prefix:           key[:apiKeyDisplayChars],
+		KeyHash:          hashApiKey(key),
+		Applications:     strings.Join(req.Applications, ","),
+		AllowedCreatedBy: strings.Join(req.AllowedCreatedBy, ","),
+	}
+
+	createdApiKey, err := uc.apiKeyRepository.CreateApiKey(apiKey)
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to create api key: ", err)
+		return nil, err
+	}
+
+	return &response.CreateApiKeyResponse{
+		ApiKeyResponse: *uc.apiKeyDTO.ConvertEntityToResponse(createdApiKey),
+		Key:            key,
+	}, nil
+}
+
+func (uc *ApiKeyUseCase) GetAllApiKeys() ([]response.ApiKeyResponse, error) {
+	apiKeys, err := uc.apiKeyRepository.GetAllApiKeys()
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to get all api keys: ", err)
+		return nil, err
+	}
+
+	var responses []response.ApiKeyResponse
+	for _, apiKey := range apiKeys {
+		response := uc.apiKeyDTO.ConvertEntityToResponse(&apiKey)
+		responses = append(responses, *response)
+	}
+
+	return responses, nil
+}
+
+func (uc *ApiKeyUseCase) RevokeApiKey(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidApiKeyID
+	}
+	apiKey, err := uc.apiKeyRepository.FindByKeys(map[string]interface{}{"id": id})
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to find api key by ID: ", err)
+		return err
+	}
+
+	if apiKey == nil {
+		return ErrApiKeyNotFound
+	}
+
+	if apiKey.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	apiKey.RevokedAt = &now
+	_, err = uc.apiKeyRepository.UpdateApiKey(apiKey)
+	return err
+}
+
+// Authenticate resolves a plaintext key to a service principal bound to the
+// applications and created_by values the key was issued for.
+func (uc *ApiKeyUseCase) Authenticate(key string) (*auth.Principal, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidApiKey
+	}
+
+	apiKey, err := uc.apiKeyRepository.FindByKeys(map[string]interface{}{"key_hash": hashApiKey(key)})
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to find api key by hash: ", err)
+		return nil, err
+	}
+
+	if apiKey == nil || apiKey.RevokedAt != nil {
+		return nil, ErrInvalidApiKey
+	}
+
+	var allowedCreatedBy []uuid.UUID
+	for _, createdBy := range apiKey.GetAllowedCreatedBy() {
+		parsed, err := uuid.Parse(createdBy)
+		if err != nil {
+			uc.log.GetLogger().Error("Invalid allowed_created_by stored on api key: ", "api_key_id", apiKey.ID, "value", createdBy)
+			continue
+		}
+		allowedCreatedBy = append(allowedCreatedBy, parsed)
+	}
+
+	return &auth.Principal{
+		Role:             auth.RoleService,
+		Applications:     apiKey.GetApplications(),
+		AllowedCreatedBy: allowedCreatedBy,
+		ApiKeyID:         apiKey.ID,
+	}, nil
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
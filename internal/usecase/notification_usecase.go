@@ -1,9 +1,13 @@
 package usecase
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/dto"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/repository"
@@ -15,156 +19,264 @@ import (
 )
 
 type INotificationUseCase interface {
-	CreateNotification(req *request.CreateNotificationRequest) error
-	GetNotificationsByKeys(keys map[string]interface{}, page, pageSize int, search string, sort map[string]interface{}) ([]response.NotificationResponse, int64, error)
-	GetAllNotifications() ([]response.NotificationResponse, error)
-	FindByID(id string) (*response.NotificationResponse, error)
-	GetByUserID(userID string) ([]response.NotificationResponse, error)
-	UpdateNotification(req *request.UpdateNotificationRequest) (*response.NotificationResponse, error)
-	DeleteNotification(id string) error
-	GetUnreadNotificationCount(userID string, application string) (int64, error)
+	CreateNotification(ctx context.Context, principal *auth.Principal, req *request.CreateNotificationRequest) (*response.CreateNotificationResponse, error)
+	GetNotificationsByKeys(ctx context.Context, principal *auth.Principal, keys map[string]interface{}, page, pageSize int, search string, sort map[string]interface{}) ([]response.NotificationResponse, int64, error)
+	GetAllNotifications(ctx context.Context, principal *auth.Principal) ([]response.NotificationResponse, error)
+	FindByID(ctx context.Context, principal *auth.Principal, id string) (*response.NotificationResponse, error)
+	GetByUserID(ctx context.Context, principal *auth.Principal, userID string) ([]response.NotificationResponse, error)
+	UpdateNotification(ctx context.Context, principal *auth.Principal, req *request.UpdateNotificationRequest) (*response.NotificationResponse, error)
+	DeleteNotification(ctx context.Context, principal *auth.Principal, id string) error
+	GetUnreadNotificationCount(ctx context.Context, principal *auth.Principal, userID string, application string) (int64, error)
+	GetUnreadCountsByApplication(ctx context.Context, principal *auth.Principal, userID string, applications []string) (map[string]int64, error)
+	MarkNotificationRead(ctx context.Context, principal *auth.Principal, id string) (*response.NotificationResponse, error)
+	DeleteNotificationsBySource(ctx context.Context, principal *auth.Principal, req *request.NotificationSourceRequest) (int64, error)
+	MarkNotificationsReadBySource(ctx context.Context, principal *auth.Principal, req *request.NotificationSourceRequest) (int64, error)
+	MarkNotifications(ctx context.Context, principal *auth.Principal, req *request.MarkNotificationsRequest) (int64, error)
+	ReplayNotifications(ctx context.Context, principal *auth.Principal, req *request.ReplayNotificationsRequest) ([]websocket.WsNotification, bool, error)
 }
 
+// ErrValidation is wrapped by every error about malformed input, which REST
+// answers with 400 and the AMQP consumer replies to instead of retrying.
+var ErrValidation = errors.New("validation error")
+
+var (
+	ErrInvalidUserID        = NewValidationError("invalid user ID format")
+	ErrReplayCursorNotFound = errors.New("last_event_id is not a notification of the user, send since as well")
+)
+
+type validationError struct {
+	message string
+}
+
+func (e *validationError) Error() string {
+	return e.message
+}
+
+func (e *validationError) Unwrap() error {
+	return ErrValidation
+}
+
+// NewValidationError returns an error with message that matches ErrValidation.
+func NewValidationError(message string) error {
+	return &validationError{message: message}
+}
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	// defaultCreateLookupTimeout keeps an SSO outage from stalling every create
+	defaultCreateLookupTimeout = time.Second
+	// maxReplayNotifications caps what a reconnecting socket is sent, clients
+	// that missed more should reload the list over REST
+	maxReplayNotifications = 500
+)
+
 type NotificationUseCase struct {
-	log                    logger.Logger
-	notificationDTO        dto.INotificationDTO
-	notificationRepository repository.INotificationRepository
-	hub                    *websocket.Hub
+	log                      logger.Logger
+	notificationDTO          dto.INotificationDTO
+	notificationRepository   repository.INotificationRepository
+	idempotencyKeyRepository repository.IIdempotencyKeyRepository
+	authorizer               auth.INotificationAuthorizer
+	hub                      *websocket.Hub
+	idempotencyTTL           time.Duration
+	createLookupTimeout      time.Duration
 }
 
 func NewNotificationUseCase(
 	log logger.Logger,
+	conf config.Config,
 	notificationDTO dto.INotificationDTO,
 	notificationRepository repository.INotificationRepository,
+	idempotencyKeyRepository repository.IIdempotencyKeyRepository,
+	authorizer auth.INotificationAuthorizer,
 	hub *websocket.Hub) INotificationUseCase {
+	idempotencyTTL := defaultIdempotencyTTL
+	if conf.Idempotency != nil && conf.Idempotency.Ttl > 0 {
+		idempotencyTTL = time.Duration(conf.Idempotency.Ttl) * time.Second
+	}
+	createLookupTimeout := defaultCreateLookupTimeout
+	if conf.UserCache != nil && conf.UserCache.CreateTimeout > 0 {
+		createLookupTimeout = time.Duration(conf.UserCache.CreateTimeout) * time.Second
+	}
+
 	return &NotificationUseCase{
-		log:                    log,
-		notificationDTO:        notificationDTO,
-		notificationRepository: notificationRepository,
-		hub:                    hub,
+		log:                      log,
+		notificationDTO:          notificationDTO,
+		notificationRepository:   notificationRepository,
+		idempotencyKeyRepository: idempotencyKeyRepository,
+		authorizer:               authorizer,
+		hub:                      hub,
+		idempotencyTTL:           idempotencyTTL,
+		createLookupTimeout:      createLookupTimeout,
 	}
 }
 
-func (uc *NotificationUseCase) CreateNotification(req *request.CreateNotificationRequest) error {
+// CreateNotification validates every recipient before writing anything, inserts
+// all rows in one transaction and only broadcasts once the rows are committed.
+// A repeated idempotency key returns the IDs created by the first request.
+func (uc *NotificationUseCase) CreateNotification(ctx context.Context, principal *auth.Principal, req *request.CreateNotificationRequest) (*response.CreateNotificationResponse, error) {
 	if len(req.UserIDs) == 0 {
-		return errors.New("user_ids cannot be empty")
+		return nil, NewValidationError("user_ids cannot be empty")
 	}
 	createdByUUID, err := uuid.Parse(req.CreatedBy)
 	if err != nil {
-		return errors.New("invalid created_by format")
+		return nil, NewValidationError("invalid created_by format")
+	}
+	if err := uc.authorizer.AuthorizeCreate(principal, req.Application, createdByUUID); err != nil {
+		return nil, err
+	}
+
+	var idempotencyKey *entity.IdempotencyKey
+	if req.IdempotencyKey != "" {
+		res, err := uc.findIdempotentResult(req.IdempotencyKey, req.Application, createdByUUID)
+		if err != nil || res != nil {
+			return res, err
+		}
+		idempotencyKey = &entity.IdempotencyKey{
+			Key:         req.IdempotencyKey,
+			Application: req.Application,
+			CreatedBy:   createdByUUID,
+			ExpiresAt:   time.Now().Add(uc.idempotencyTTL),
+		}
 	}
 
+	notifications := make([]entity.Notification, 0, len(req.UserIDs))
+	userUUIDs := make([]uuid.UUID, 0, len(req.UserIDs))
 	for _, userID := range req.UserIDs {
 		userUUID, err := uuid.Parse(userID)
 		if err != nil {
-			return errors.New("invalid user_id format")
+			return nil, NewValidationError(fmt.Sprintf("invalid user_id format: %s", userID))
 		}
 
-		notification := &entity.Notification{
+		notifications = append(notifications, entity.Notification{
 			Application: req.Application,
 			Name:        req.Name,
 			URL:         req.URL,
 			Message:     req.Message,
 			UserID:      userUUID,
 			CreatedBy:   createdByUUID,
-		}
-
-		createdNotification, err := uc.notificationRepository.CreateNotification(notification)
-		if err != nil {
-			uc.log.GetLogger().Error("Failed to create notification: ", err)
-			return err
-		}
+			SourceType:  req.SourceType,
+			SourceID:    req.SourceID,
+		})
+		userUUIDs = append(userUUIDs, userUUID)
+	}
 
-		unreadCount, err := uc.notificationRepository.GetUnreadNotificationCount(userUUID, req.Application)
-		if err != nil {
-			uc.log.GetLogger().Error("Failed to get unread notification count: ", err)
-			return err
+	// keep the names as they are today, so that history does not change. Names
+	// the SSO does not return in time stay empty and are resolved on read.
+	lookupCtx, cancel := context.WithTimeout(ctx, uc.createLookupTimeout)
+	defer cancel()
+	uc.notificationDTO.FillUserNames(lookupCtx, notifications)
+
+	if err := uc.notificationRepository.CreateNotifications(notifications, idempotencyKey); err != nil {
+		if idempotencyKey != nil {
+			// a concurrent request with the same key may have won the race
+			if res, findErr := uc.findIdempotentResult(req.IdempotencyKey, req.Application, createdByUUID); findErr == nil && res != nil {
+				return res, nil
+			}
 		}
+		uc.log.GetLogger().Error("Failed to create notifications: ", err)
+		return nil, err
+	}
 
-		createdNotification.UnreadCount = unreadCount
+	res := &response.CreateNotificationResponse{
+		IDs: make([]uuid.UUID, 0, len(notifications)),
+	}
+	for _, notification := range notifications {
+		res.IDs = append(res.IDs, notification.ID)
+	}
 
-		wsNotification := uc.notificationDTO.ConvertEntityToWebsocketResponse(createdNotification)
-		uc.hub.BroadcastNotification(*wsNotification)
+	// the rows are committed at this point, a failed count must not fail the request
+	unreadCounts, err := uc.notificationRepository.GetUnreadNotificationCounts(userUUIDs, req.Application)
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to get unread notification counts: ", err)
+	}
+	for i := range notifications {
+		notifications[i].UnreadCount = unreadCounts[notifications[i].UserID]
+	}
+	for _, wsNotification := range uc.notificationDTO.ConvertEntitiesToWebsocketResponses(lookupCtx, notifications) {
+		uc.hub.BroadcastNotification(wsNotification)
 	}
 
-	return nil
+	return res, nil
 }
 
-func (uc *NotificationUseCase) GetNotificationsByKeys(keys map[string]interface{}, page, pageSize int, search string, sort map[string]interface{}) ([]response.NotificationResponse, int64, error) {
+func (uc *NotificationUseCase) GetNotificationsByKeys(ctx context.Context, principal *auth.Principal, keys map[string]interface{}, page, pageSize int, search string, sort map[string]interface{}) ([]response.NotificationResponse, int64, error) {
+	if err := uc.authorizer.ScopeKeys(principal, keys); err != nil {
+		return nil, 0, err
+	}
+
 	notifications, total, err := uc.notificationRepository.GetNotificationsByKeysPagination(keys, page, pageSize, search, sort)
 	if err != nil {
 		uc.log.GetLogger().Error("Failed to get notifications by keys: ", err)
 		return nil, 0, err
 	}
 
-	var responses []response.NotificationResponse
-	for _, notification := range notifications {
-		response := uc.notificationDTO.ConvertEntityToResponse(&notification)
-		responses = append(responses, *response)
-	}
+	responses := uc.notificationDTO.ConvertEntitiesToResponses(ctx, notifications)
 
 	return responses, total, nil
 }
 
-func (uc *NotificationUseCase) GetAllNotifications() ([]response.NotificationResponse, error) {
+func (uc *NotificationUseCase) GetAllNotifications(ctx context.Context, principal *auth.Principal) ([]response.NotificationResponse, error) {
+	if err := uc.authorizer.AuthorizeListAll(principal); err != nil {
+		return nil, err
+	}
+
 	notifications, err := uc.notificationRepository.GetAllNotifications()
 	if err != nil {
 		uc.log.GetLogger().Error("Failed to get all notifications: ", err)
 		return nil, err
 	}
 
-	var responses []response.NotificationResponse
-	for _, notification := range notifications {
-		response := uc.notificationDTO.ConvertEntityToResponse(&notification)
-		responses = append(responses, *response)
-	}
+	responses := uc.notificationDTO.ConvertEntitiesToResponses(ctx, notifications)
 
 	return responses, nil
 }
 
-func (uc *NotificationUseCase) FindByID(id string) (*response.NotificationResponse, error) {
-	notification, err := uc.notificationRepository.FindByKeys(map[string]interface{}{"id": id})
+func (uc *NotificationUseCase) FindByID(ctx context.Context, principal *auth.Principal, id string) (*response.NotificationResponse, error) {
+	notification, err := uc.findAuthorizedNotification(principal, id)
 	if err != nil {
-		uc.log.GetLogger().Error("Failed to find notification by ID: ", err)
 		return nil, err
 	}
 
-	if notification == nil {
-		return nil, nil
-	}
-
-	response := uc.notificationDTO.ConvertEntityToResponse(notification)
+	response := uc.notificationDTO.ConvertEntityToResponse(ctx, notification)
 	return response, nil
 }
 
-func (uc *NotificationUseCase) GetByUserID(userID string) ([]response.NotificationResponse, error) {
-	notifications, err := uc.notificationRepository.GetNotificationsByKeys(map[string]interface{}{"user_id": userID})
+func (uc *NotificationUseCase) GetByUserID(ctx context.Context, principal *auth.Principal, userID string) ([]response.NotificationResponse, error) {
+	parsedUserID, err := uuid.Parse(userID)
 	if err != nil {
-		uc.log.GetLogger().Error("Failed to get notifications by user ID: ", err)
+		return nil, ErrInvalidUserID
+	}
+	if err := uc.authorizer.AuthorizeUser(principal, parsedUserID); err != nil {
 		return nil, err
 	}
 
-	var responses []response.NotificationResponse
-	for _, notification := range notifications {
-		response := uc.notificationDTO.ConvertEntityToResponse(&notification)
-		responses = append(responses, *response)
+	keys := map[string]interface{}{"user_id": userID}
+	if err := uc.authorizer.ScopeKeys(principal, keys); err != nil {
+		return nil, err
+	}
+
+	notifications, err := uc.notificationRepository.GetNotificationsByKeys(keys)
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to get notifications by user ID: ", err)
+		return nil, err
 	}
 
+	responses := uc.notificationDTO.ConvertEntitiesToResponses(ctx, notifications)
+
 	return responses, nil
 }
 
-func (uc *NotificationUseCase) UpdateNotification(req *request.UpdateNotificationRequest) (*response.NotificationResponse, error) {
-	notification, err := uc.notificationRepository.FindByKeys(map[string]interface{}{"id": req.ID})
+func (uc *NotificationUseCase) UpdateNotification(ctx context.Context, principal *auth.Principal, req *request.UpdateNotificationRequest) (*response.NotificationResponse, error) {
+	notification, err := uc.findAuthorizedNotification(principal, req.ID)
 	if err != nil {
-		uc.log.GetLogger().Error("Failed to find notification by ID: ", err)
 		return nil, err
 	}
-
-	if notification == nil {
-		return nil, errors.New("notification not found")
-	}
+	previous := *notification
 
 	if req.Application != "" {
+		if !principal.CanAccessApplication(req.Application) {
+			return nil, auth.ErrForbidden
+		}
 		notification.Application = req.Application
 	}
 	if req.Name != "" {
@@ -180,7 +292,7 @@ func (uc *NotificationUseCase) UpdateNotification(req *request.UpdateNotificatio
 		// parsedTime, err := time.Parse("2006-01-02 15:04:05", *req.ReadAt)
 		parsedTime, err := time.Parse(time.RFC3339, *req.ReadAt)
 		if err != nil {
-			return nil, errors.New("invalid ReadAt format, must be RFC3339")
+			return nil, NewValidationError("invalid ReadAt format, must be RFC3339")
 		}
 		notification.ReadAt = &parsedTime
 	}
@@ -190,34 +302,47 @@ func (uc *NotificationUseCase) UpdateNotification(req *request.UpdateNotificatio
 		return nil, err
 	}
 
-	response := uc.notificationDTO.ConvertEntityToResponse(notification)
+	wsNotification := uc.notificationDTO.ConvertEntityToWebsocketResponse(ctx, notification)
+	uc.hub.BroadcastNotificationUpdated(*wsNotification)
+	if previous.Application != notification.Application {
+		uc.hub.BroadcastNotificationDeleted(previous.ID, previous.UserID, previous.Application)
+	}
+
+	// the notification may have moved to another application or changed its read state
+	uc.broadcastUnreadCounts([]entity.Notification{previous, *notification})
+
+	response := uc.notificationDTO.ConvertEntityToResponse(ctx, notification)
 	return response, nil
 }
 
-func (uc *NotificationUseCase) DeleteNotification(id string) error {
-	notification, err := uc.notificationRepository.FindByKeys(map[string]interface{}{"id": id})
+func (uc *NotificationUseCase) DeleteNotification(ctx context.Context, principal *auth.Principal, id string) error {
+	notification, err := uc.findAuthorizedNotification(principal, id)
 	if err != nil {
-		uc.log.GetLogger().Error("Failed to find notification by ID: ", err)
 		return err
 	}
 
-	if notification == nil {
-		return errors.New("notification not found")
-	}
-
 	err = uc.notificationRepository.DeleteNotification(notification.ID)
 	if err != nil {
 		return err
 	}
 
+	uc.hub.BroadcastNotificationDeleted(notification.ID, notification.UserID, notification.Application)
+	uc.broadcastUnreadCounts([]entity.Notification{*notification})
+
 	return nil
 }
 
-func (uc *NotificationUseCase) GetUnreadNotificationCount(userID string, application string) (int64, error) {
+func (uc *NotificationUseCase) GetUnreadNotificationCount(ctx context.Context, principal *auth.Principal, userID string, application string) (int64, error) {
 	parsedUserID, err := uuid.Parse(userID)
 	if err != nil {
 		uc.log.GetLogger().Error("Invalid user ID format: ", err)
-		return 0, errors.New("invalid user ID format")
+		return 0, ErrInvalidUserID
+	}
+	if err := uc.authorizer.AuthorizeUser(principal, parsedUserID); err != nil {
+		return 0, err
+	}
+	if !principal.CanAccessApplication(application) {
+		return 0, auth.ErrForbidden
 	}
 	notification, err := uc.notificationRepository.GetUnreadNotificationCount(parsedUserID, application)
 	if err != nil {
@@ -226,3 +351,301 @@ func (uc *NotificationUseCase) GetUnreadNotificationCount(userID string, applica
 	}
 	return notification, nil
 }
+
+// GetUnreadCountsByApplication returns the user's unread count for each of
+// applications, or for every application with unread notifications when the
+// list is empty.
+func (uc *NotificationUseCase) GetUnreadCountsByApplication(ctx context.Context, principal *auth.Principal, userID string, applications []string) (map[string]int64, error) {
+	parsedUserID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	if err := uc.authorizer.AuthorizeUser(principal, parsedUserID); err != nil {
+		return nil, err
+	}
+	for _, application := range applications {
+		if !principal.CanAccessApplication(application) {
+			return nil, auth.ErrForbidden
+		}
+	}
+	if len(applications) == 0 && principal.IsService() && !principal.HasAllApplications() {
+		if len(principal.Applications) == 0 {
+			return nil, auth.ErrForbidden
+		}
+		applications = principal.Applications
+	}
+
+	counts, err := uc.notificationRepository.GetUnreadNotificationCountsByApplication(parsedUserID, applications)
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to get unread notification counts by application: ", err)
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (uc *NotificationUseCase) MarkNotificationRead(ctx context.Context, principal *auth.Principal, id string) (*response.NotificationResponse, error) {
+	notification, err := uc.findAuthorizedNotification(principal, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if notification.ReadAt == nil {
+		now := time.Now()
+		notification.ReadAt = &now
+		if _, err := uc.notificationRepository.UpdateNotification(notification); err != nil {
+			return nil, err
+		}
+		// the user's other tabs update the read state as well as the badge
+		wsNotification := uc.notificationDTO.ConvertEntityToWebsocketResponse(ctx, notification)
+		uc.hub.BroadcastNotificationUpdated(*wsNotification)
+		uc.broadcastUnreadCounts([]entity.Notification{*notification})
+	}
+
+	response := uc.notificationDTO.ConvertEntityToResponse(ctx, notification)
+	return response, nil
+}
+
+// DeleteNotificationsBySource retracts every notification raised for a
+// business object, e.g. once the approval it asked for is completed.
+func (uc *NotificationUseCase) DeleteNotificationsBySource(ctx context.Context, principal *auth.Principal, req *request.NotificationSourceRequest) (int64, error) {
+	if err := uc.authorizer.AuthorizeApplication(principal, req.Application); err != nil {
+		return 0, err
+	}
+
+	notifications, err := uc.notificationRepository.DeleteNotificationsByKeys(sourceKeys(req))
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to delete notifications by source: ", err)
+		return 0, err
+	}
+
+	for _, notification := range notifications {
+		uc.hub.BroadcastNotificationDeleted(notification.ID, notification.UserID, notification.Application)
+	}
+	uc.broadcastUnreadCounts(notifications)
+
+	return int64(len(notifications)), nil
+}
+
+func (uc *NotificationUseCase) MarkNotificationsReadBySource(ctx context.Context, principal *auth.Principal, req *request.NotificationSourceRequest) (int64, error) {
+	if err := uc.authorizer.AuthorizeApplication(principal, req.Application); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	notifications, err := uc.notificationRepository.UpdateNotificationsReadAt(sourceKeys(req), nil, nil, &now)
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to mark notifications read by source: ", err)
+		return 0, err
+	}
+
+	uc.broadcastUnreadCounts(notifications)
+
+	return int64(len(notifications)), nil
+}
+
+// MarkNotifications marks the selected notifications read with the server time,
+// or unread when req.Unread is set, and refreshes the unread badge of every
+// affected user. Only the caller's own notifications are touched, whatever the
+// role, so that an admin marking all as read does not clear other badges.
+func (uc *NotificationUseCase) MarkNotifications(ctx context.Context, principal *auth.Principal, req *request.MarkNotificationsRequest) (int64, error) {
+	if principal == nil || principal.UserID == uuid.Nil {
+		return 0, auth.ErrForbidden
+	}
+	keys := map[string]interface{}{"user_id": principal.UserID.String()}
+	if req.Application != "" {
+		keys["application"] = req.Application
+	}
+	if req.SourceType != "" {
+		keys["source_type"] = req.SourceType
+		keys["source_id"] = req.SourceID
+	}
+	if err := uc.authorizer.ScopeKeys(principal, keys); err != nil {
+		return 0, err
+	}
+
+	ids := make([]uuid.UUID, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		parsedID, err := uuid.Parse(id)
+		if err != nil {
+			return 0, NewValidationError(fmt.Sprintf("invalid id format: %s", id))
+		}
+		ids = append(ids, parsedID)
+	}
+
+	var before *time.Time
+	if req.Before != "" {
+		parsedTime, err := time.Parse(time.RFC3339, req.Before)
+		if err != nil {
+			return 0, NewValidationError("invalid before format, must be RFC3339")
+		}
+		before = &parsedTime
+	}
+
+	var readAt *time.Time
+	if !req.Unread {
+		now := time.Now()
+		readAt = &now
+	}
+
+	notifications, err := uc.notificationRepository.UpdateNotificationsReadAt(keys, ids, before, readAt)
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to mark notifications: ", err)
+		return 0, err
+	}
+
+	uc.broadcastUnreadCounts(notifications)
+
+	return int64(len(notifications)), nil
+}
+
+// ReplayNotifications returns the user's notifications created after the
+// cursor, oldest first. The second result reports whether the replay was cut
+// off at maxReplayNotifications.
+func (uc *NotificationUseCase) ReplayNotifications(ctx context.Context, principal *auth.Principal, req *request.ReplayNotificationsRequest) ([]websocket.WsNotification, bool, error) {
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return nil, false, ErrInvalidUserID
+	}
+	if err := uc.authorizer.AuthorizeUser(principal, userID); err != nil {
+		return nil, false, err
+	}
+
+	if req.LastEventID == "" && req.Since == "" {
+		return nil, false, nil
+	}
+
+	var after time.Time
+	afterID := uuid.Nil
+	if req.LastEventID != "" {
+		// only notification_created events carry a notification ID, other event
+		// IDs and notifications of someone else fall back to since
+		last, err := uc.notificationRepository.FindByKeysIncludingDeleted(map[string]interface{}{"id": req.LastEventID})
+		if err != nil {
+			uc.log.GetLogger().Error("Failed to find replay cursor: ", err)
+			return nil, false, err
+		}
+		if last != nil && uc.authorizer.AuthorizeNotification(principal, last) == nil {
+			after = last.CreatedAt
+			afterID = last.ID
+		}
+	}
+	if afterID == uuid.Nil {
+		if req.Since == "" {
+			return nil, false, ErrReplayCursorNotFound
+		}
+		after, err = time.Parse(time.RFC3339, req.Since)
+		if err != nil {
+			return nil, false, NewValidationError("invalid since format, must be RFC3339")
+		}
+	}
+
+	keys := map[string]interface{}{"user_id": userID.String()}
+	if len(req.Applications) > 0 {
+		keys["application"] = req.Applications
+	}
+	if err := uc.authorizer.ScopeKeys(principal, keys); err != nil {
+		return nil, false, err
+	}
+
+	notifications, err := uc.notificationRepository.GetNotificationsCreatedAfter(keys, after, afterID, maxReplayNotifications)
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to get notifications to replay: ", err)
+		return nil, false, err
+	}
+
+	return uc.notificationDTO.ConvertEntitiesToWebsocketResponses(ctx, notifications), len(notifications) == maxReplayNotifications, nil
+}
+
+// broadcastUnreadCounts sends an unread_count_changed event for every user and
+// application pair in notifications, with one grouped query per application.
+func (uc *NotificationUseCase) broadcastUnreadCounts(notifications []entity.Notification) {
+	userIDsByApplication := make(map[string][]uuid.UUID)
+	seen := make(map[string]map[uuid.UUID]bool)
+	for _, notification := range notifications {
+		if seen[notification.Application] == nil {
+			seen[notification.Application] = make(map[uuid.UUID]bool)
+		}
+		if !seen[notification.Application][notification.UserID] {
+			seen[notification.Application][notification.UserID] = true
+			userIDsByApplication[notification.Application] = append(userIDsByApplication[notification.Application], notification.UserID)
+		}
+	}
+
+	for application, userIDs := range userIDsByApplication {
+		unreadCounts, err := uc.notificationRepository.GetUnreadNotificationCounts(userIDs, application)
+		if err != nil {
+			uc.log.GetLogger().Error("Failed to get unread notification counts: ", err)
+			continue
+		}
+		for userID, unreadCount := range unreadCounts {
+			uc.hub.BroadcastUnreadCount(userID, application, unreadCount)
+		}
+	}
+}
+
+// findIdempotentResult returns the result stored for an unexpired key, or nil
+// when the request has not been seen. Expired keys are removed so that they
+// can be used again.
+func (uc *NotificationUseCase) findIdempotentResult(key string, application string, createdBy uuid.UUID) (*response.CreateNotificationResponse, error) {
+	idempotencyKey, err := uc.idempotencyKeyRepository.FindByKeys(map[string]interface{}{
+		"idempotency_key": key,
+		"application":     application,
+		"created_by":      createdBy,
+	})
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to find idempotency key: ", err)
+		return nil, err
+	}
+	if idempotencyKey == nil {
+		return nil, nil
+	}
+
+	if idempotencyKey.IsExpired() {
+		if err := uc.idempotencyKeyRepository.DeleteIdempotencyKey(idempotencyKey.ID); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	return &response.CreateNotificationResponse{
+		IDs: idempotencyKey.GetNotificationIDs(),
+	}, nil
+}
+
+// findAuthorizedNotification reports a malformed id as not found, like the ID
+// of a notification the caller may not see.
+func (uc *NotificationUseCase) findAuthorizedNotification(principal *auth.Principal, id string) (*entity.Notification, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, auth.ErrNotFound
+	}
+	notification, err := uc.notificationRepository.FindByKeys(map[string]interface{}{"id": id})
+	if err != nil {
+		uc.log.GetLogger().Error("Failed to find notification by ID: ", err)
+		return nil, err
+	}
+
+	if notification == nil {
+		return nil, auth.ErrNotFound
+	}
+
+	if err := uc.authorizer.AuthorizeNotification(principal, notification); err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+// sourceKeys prefers the source reference and falls back to the URL for
+// notifications created before source_type and source_id existed.
+func sourceKeys(req *request.NotificationSourceRequest) map[string]interface{} {
+	keys := map[string]interface{}{
+		"application": req.Application,
+	}
+	if req.SourceType != "" {
+		keys["source_type"] = req.SourceType
+		keys["source_id"] = req.SourceID
+	} else {
+		keys["url"] = req.URL
+	}
+	return keys
+}
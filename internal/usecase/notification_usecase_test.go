@@ -0,0 +1,761 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IlhamSetiaji/julong-notification-be/config"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/dto"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/entity"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/request"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/response"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/websocket"
+	"github.com/IlhamSetiaji/julong-notification-be/logger"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeNotificationRepository keeps notifications in memory and filters them
+// the way the gorm repository's WHERE clauses do.
+type fakeNotificationRepository struct {
+	notifications []entity.Notification
+	created       [][]entity.Notification
+
+	// the arguments of the last UpdateNotificationsReadAt call
+	readAtKeys   map[string]interface{}
+	readAtIDs    []uuid.UUID
+	readAtBefore *time.Time
+	readAt       *time.Time
+}
+
+func (f *fakeNotificationRepository) CreateNotification(ent *entity.Notification) (*entity.Notification, error) {
+	return ent, f.CreateNotifications([]entity.Notification{*ent}, nil)
+}
+
+func (f *fakeNotificationRepository) CreateNotifications(ents []entity.Notification, idempotencyKey *entity.IdempotencyKey) error {
+	for i := range ents {
+		ents[i].ID = uuid.New()
+		ents[i].CreatedAt = time.Now()
+	}
+	f.created = append(f.created, ents)
+	f.notifications = append(f.notifications, ents...)
+	return nil
+}
+
+func (f *fakeNotificationRepository) GetNotificationsByKeys(keys map[string]interface{}) ([]entity.Notification, error) {
+	return f.find(keys), nil
+}
+
+func (f *fakeNotificationRepository) GetNotificationsByKeysPagination(keys map[string]interface{}, page, pageSize int, search string, sort map[string]interface{}) ([]entity.Notification, int64, error) {
+	notifications := f.find(keys)
+	return notifications, int64(len(notifications)), nil
+}
+
+func (f *fakeNotificationRepository) GetAllNotifications() ([]entity.Notification, error) {
+	return f.find(nil), nil
+}
+
+func (f *fakeNotificationRepository) FindByKeys(keys map[string]interface{}) (*entity.Notification, error) {
+	if notifications := f.find(keys); len(notifications) > 0 {
+		return &notifications[0], nil
+	}
+	return nil, nil
+}
+
+func (f *fakeNotificationRepository) FindByKeysIncludingDeleted(keys map[string]interface{}) (*entity.Notification, error) {
+	for _, notification := range f.notifications {
+		if matchesKeys(notification, keys) {
+			return &notification, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeNotificationRepository) UpdateNotification(ent *entity.Notification) (*entity.Notification, error) {
+	for i := range f.notifications {
+		if f.notifications[i].ID == ent.ID {
+			f.notifications[i] = *ent
+		}
+	}
+	return ent, nil
+}
+
+func (f *fakeNotificationRepository) DeleteNotification(id uuid.UUID) error {
+	_, err := f.DeleteNotificationsByKeys(map[string]interface{}{"id": id.String()})
+	return err
+}
+
+func (f *fakeNotificationRepository) DeleteNotificationsByKeys(keys map[string]interface{}) ([]entity.Notification, error) {
+	var deleted []entity.Notification
+	for i := range f.notifications {
+		if !f.notifications[i].DeletedAt.Valid && matchesKeys(f.notifications[i], keys) {
+			f.notifications[i].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			deleted = append(deleted, f.notifications[i])
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeNotificationRepository) UpdateNotificationsReadAt(keys map[string]interface{}, ids []uuid.UUID, before *time.Time, readAt *time.Time) ([]entity.Notification, error) {
+	f.readAtKeys, f.readAtIDs, f.readAtBefore, f.readAt = keys, ids, before, readAt
+
+	var updated []entity.Notification
+	for _, notification := range f.find(keys) {
+		if len(ids) > 0 && !containsID(ids, notification.ID) {
+			continue
+		}
+		if before != nil && !notification.CreatedAt.Before(*before) {
+			continue
+		}
+		if (readAt != nil) != (notification.ReadAt == nil) {
+			continue
+		}
+		updated = append(updated, notification)
+	}
+	return updated, nil
+}
+
+func (f *fakeNotificationRepository) GetUnreadNotificationCount(userID uuid.UUID, application string) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeNotificationRepository) GetUnreadNotificationCounts(userIDs []uuid.UUID, application string) (map[uuid.UUID]int64, error) {
+	return map[uuid.UUID]int64{}, nil
+}
+
+func (f *fakeNotificationRepository) GetUnreadNotificationCountsByApplication(userID uuid.UUID, applications []string) (map[string]int64, error) {
+	return map[string]int64{}, nil
+}
+
+func (f *fakeNotificationRepository) GetNotificationsCreatedAfter(keys map[string]interface{}, after time.Time, afterID uuid.UUID, limit int) ([]entity.Notification, error) {
+	var notifications []entity.Notification
+	for _, notification := range f.find(keys) {
+		if notification.CreatedAt.After(after) ||
+			(afterID != uuid.Nil && notification.CreatedAt.Equal(after) && notification.ID.String() > afterID.String()) {
+			notifications = append(notifications, notification)
+		}
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		if !notifications[i].CreatedAt.Equal(notifications[j].CreatedAt) {
+			return notifications[i].CreatedAt.Before(notifications[j].CreatedAt)
+		}
+		return notifications[i].ID.String() < notifications[j].ID.String()
+	})
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+	}
+	return notifications, nil
+}
+
+func (f *fakeNotificationRepository) GetNotificationsWithoutUserNames(afterID uuid.UUID, limit int) ([]entity.Notification, error) {
+	return nil, nil
+}
+
+func (f *fakeNotificationRepository) UpdateUserNames(id uuid.UUID, userName string, createdByName string) error {
+	return nil
+}
+
+// find returns the notifications that are not deleted and match keys.
+func (f *fakeNotificationRepository) find(keys map[string]interface{}) []entity.Notification {
+	var notifications []entity.Notification
+	for _, notification := range f.notifications {
+		if !notification.DeletedAt.Valid && matchesKeys(notification, keys) {
+			notifications = append(notifications, notification)
+		}
+	}
+	return notifications
+}
+
+func matchesKeys(notification entity.Notification, keys map[string]interface{}) bool {
+	columns := map[string]string{
+		"id":          notification.ID.String(),
+		"user_id":     notification.UserID.String(),
+		"application": notification.Application,
+		"source_type": notification.SourceType,
+		"source_id":   notification.SourceID,
+		"url":         notification.URL,
+	}
+	for key, value := range keys {
+		column, ok := columns[key]
+		if !ok {
+			panic("fake repository cannot filter by " + key)
+		}
+		if values, ok := value.([]string); ok {
+			if !containsString(values, column) {
+				return false
+			}
+		} else if fmt.Sprint(value) != column {
+			return false
+		}
+	}
+	return true
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeIdempotencyKeyRepository struct {
+	keys []entity.IdempotencyKey
+}
+
+func (f *fakeIdempotencyKeyRepository) FindByKeys(keys map[string]interface{}) (*entity.IdempotencyKey, error) {
+	for _, key := range f.keys {
+		if key.Key == keys["idempotency_key"] && key.Application == keys["application"] && key.CreatedBy == keys["created_by"] {
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeIdempotencyKeyRepository) DeleteIdempotencyKey(id uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeIdempotencyKeyRepository) DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	return 0, nil
+}
+
+// fakeUserMessage knows no users, so names stay empty.
+type fakeUserMessage struct{}
+
+func (fakeUserMessage) SendFindUserByIDMessage(ctx context.Context, req request.SendFindUserByIDMessageRequest) (*response.SendFindUserByIDResponse, error) {
+	return &response.SendFindUserByIDResponse{}, nil
+}
+
+func (fakeUserMessage) SendFindUsersByIDsMessage(ctx context.Context, req request.SendFindUsersByIDsMessageRequest) (*response.SendFindUsersByIDsResponse, error) {
+	return &response.SendFindUsersByIDsResponse{}, nil
+}
+
+func (fakeUserMessage) SendGetUserMe(ctx context.Context, req request.SendFindUserByIDMessageRequest) (*response.SendGetUserMeResponse, error) {
+	return &response.SendGetUserMeResponse{}, nil
+}
+
+// recordingBackplane records what the hub broadcasts instead of delivering it.
+type recordingBackplane struct {
+	envelopes []websocket.Envelope
+	mu        sync.Mutex
+}
+
+func (b *recordingBackplane) Publish(envelope websocket.Envelope) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.envelopes = append(b.envelopes, envelope)
+	return nil
+}
+
+func (b *recordingBackplane) Subscribe(deliver func(websocket.Envelope)) {}
+
+// types returns the types of the recorded events in order.
+func (b *recordingBackplane) types() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var types []string
+	for _, envelope := range b.envelopes {
+		types = append(types, envelope.Type)
+	}
+	return types
+}
+
+type testUseCase struct {
+	*NotificationUseCase
+	repository  *fakeNotificationRepository
+	idempotency *fakeIdempotencyKeyRepository
+	backplane   *recordingBackplane
+}
+
+func newTestUseCase(notifications ...entity.Notification) *testUseCase {
+	log := logger.NewLogger()
+	repository := &fakeNotificationRepository{notifications: notifications}
+	idempotency := &fakeIdempotencyKeyRepository{}
+	backplane := &recordingBackplane{}
+	uc := NewNotificationUseCase(
+		log,
+		config.Config{},
+		dto.NewNotificationDTO(log, fakeUserMessage{}),
+		repository,
+		idempotency,
+		auth.NewNotificationAuthorizer(log),
+		websocket.NewHub(backplane, websocket.HubOptions{}),
+	).(*NotificationUseCase)
+	return &testUseCase{NotificationUseCase: uc, repository: repository, idempotency: idempotency, backplane: backplane}
+}
+
+// testNotificationID returns an ID that sorts by n, for notifications
+// created at the same time.
+func testNotificationID(n int) uuid.UUID {
+	return uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", n))
+}
+
+func testNotification(n int, userID uuid.UUID, application string, createdAt time.Time) entity.Notification {
+	notification := entity.Notification{
+		ID:          testNotificationID(n),
+		UserID:      userID,
+		Application: application,
+		Name:        fmt.Sprintf("notification %d", n),
+		URL:         fmt.Sprintf("/approvals/%d", n),
+	}
+	notification.CreatedAt = createdAt
+	return notification
+}
+
+func replayedIDs(notifications []websocket.WsNotification) string {
+	ids := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		ids = append(ids, strings.TrimLeft(strings.TrimPrefix(notification.ID.String(), "00000000-0000-0000-0000-"), "0"))
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestReplayNotifications(t *testing.T) {
+	userID := uuid.New()
+	otherUserID := uuid.New()
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	deleted := testNotification(3, userID, "MANPOWER", base.Add(2*time.Minute))
+	deleted.DeletedAt = gorm.DeletedAt{Time: base.Add(time.Hour), Valid: true}
+	notifications := []entity.Notification{
+		testNotification(1, userID, "MANPOWER", base),
+		testNotification(2, userID, "MANPOWER", base.Add(time.Minute)),
+		deleted,
+		// 4 and 5 share created_at and are ordered by ID
+		testNotification(5, userID, "RECRUITMENT", base.Add(3*time.Minute)),
+		testNotification(4, userID, "MANPOWER", base.Add(3*time.Minute)),
+		testNotification(6, otherUserID, "MANPOWER", base.Add(4*time.Minute)),
+		testNotification(7, userID, "MANPOWER", base.Add(5*time.Minute)),
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		req       request.ReplayNotificationsRequest
+		want      string
+		wantErr   error
+	}{
+		{
+			name: "no cursor replays nothing",
+			req:  request.ReplayNotificationsRequest{},
+		},
+		{
+			name: "after the last event, oldest first",
+			req:  request.ReplayNotificationsRequest{LastEventID: testNotificationID(1).String()},
+			want: "2,4,5,7",
+		},
+		{
+			name: "ties on created_at are broken by ID",
+			req:  request.ReplayNotificationsRequest{LastEventID: testNotificationID(4).String()},
+			want: "5,7",
+		},
+		{
+			name: "a deleted notification is still a cursor",
+			req:  request.ReplayNotificationsRequest{LastEventID: testNotificationID(3).String()},
+			want: "4,5,7",
+		},
+		{
+			name: "last_event_id wins over since",
+			req:  request.ReplayNotificationsRequest{LastEventID: testNotificationID(5).String(), Since: base.Format(time.RFC3339)},
+			want: "7",
+		},
+		{
+			name: "an unknown event ID falls back to since",
+			req:  request.ReplayNotificationsRequest{LastEventID: uuid.NewString(), Since: base.Add(2 * time.Minute).Format(time.RFC3339)},
+			want: "4,5,7",
+		},
+		{
+			name: "another user's notification falls back to since",
+			req:  request.ReplayNotificationsRequest{LastEventID: testNotificationID(6).String(), Since: base.Add(4 * time.Minute).Format(time.RFC3339)},
+			want: "7",
+		},
+		{
+			name:    "an unknown event ID without since",
+			req:     request.ReplayNotificationsRequest{LastEventID: uuid.NewString()},
+			wantErr: ErrReplayCursorNotFound,
+		},
+		{
+			name: "since alone",
+			req:  request.ReplayNotificationsRequest{Since: base.Format(time.RFC3339)},
+			want: "2,4,5,7",
+		},
+		{
+			name:    "malformed since",
+			req:     request.ReplayNotificationsRequest{Since: "yesterday"},
+			wantErr: ErrValidation,
+		},
+		{
+			name: "only the subscribed applications",
+			req:  request.ReplayNotificationsRequest{Since: base.Format(time.RFC3339), Applications: []string{"RECRUITMENT"}},
+			want: "5",
+		},
+		{
+			name:      "another user's replay",
+			principal: auth.NewUserPrincipal(otherUserID),
+			req:       request.ReplayNotificationsRequest{Since: base.Format(time.RFC3339)},
+			wantErr:   auth.ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := newTestUseCase(notifications...)
+			principal := tt.principal
+			if principal == nil {
+				principal = auth.NewUserPrincipal(userID)
+			}
+			tt.req.UserID = userID.String()
+
+			replayed, truncated, err := uc.ReplayNotifications(context.Background(), principal, &tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReplayNotifications() = %v, want %v", err, tt.wantErr)
+			}
+			if got := replayedIDs(replayed); got != tt.want {
+				t.Fatalf("replayed %q, want %q", got, tt.want)
+			}
+			if truncated {
+				t.Fatal("replay reported as truncated")
+			}
+		})
+	}
+}
+
+func TestReplayNotificationsTruncates(t *testing.T) {
+	userID := uuid.New()
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	var notifications []entity.Notification
+	for i := 1; i <= maxReplayNotifications+1; i++ {
+		notifications = append(notifications, testNotification(i, userID, "MANPOWER", base.Add(time.Duration(i)*time.Second)))
+	}
+	uc := newTestUseCase(notifications...)
+
+	replayed, truncated, err := uc.ReplayNotifications(context.Background(), auth.NewUserPrincipal(userID), &request.ReplayNotificationsRequest{
+		UserID: userID.String(),
+		Since:  base.Format(time.RFC3339),
+	})
+	if err != nil || !truncated || len(replayed) != maxReplayNotifications {
+		t.Fatalf("replayed %d, truncated %v, err %v", len(replayed), truncated, err)
+	}
+}
+
+func TestMarkNotifications(t *testing.T) {
+	userID := uuid.New()
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	readAt := base.Add(time.Hour)
+	read := testNotification(3, userID, "MANPOWER", base.Add(2*time.Minute))
+	read.ReadAt = &readAt
+	notifications := []entity.Notification{
+		testNotification(1, userID, "MANPOWER", base),
+		testNotification(2, userID, "RECRUITMENT", base.Add(time.Minute)),
+		read,
+		testNotification(4, uuid.New(), "MANPOWER", base),
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		req       request.MarkNotificationsRequest
+		want      int64
+		wantErr   error
+	}{
+		{
+			name: "all of the caller's unread notifications",
+			want: 2,
+		},
+		{
+			name: "by ID",
+			req:  request.MarkNotificationsRequest{IDs: []string{testNotificationID(2).String(), testNotificationID(4).String()}},
+			want: 1,
+		},
+		{
+			name: "by application",
+			req:  request.MarkNotificationsRequest{Application: "MANPOWER"},
+			want: 1,
+		},
+		{
+			name: "before a timestamp",
+			req:  request.MarkNotificationsRequest{Before: base.Add(time.Minute).Format(time.RFC3339)},
+			want: 1,
+		},
+		{
+			name: "unread",
+			req:  request.MarkNotificationsRequest{Unread: true},
+			want: 1,
+		},
+		{
+			name:      "an admin only marks their own notifications",
+			principal: &auth.Principal{UserID: uuid.New(), Role: auth.RoleAdmin},
+			want:      0,
+		},
+		{
+			name:      "a principal without a user",
+			principal: auth.NewSystemPrincipal(),
+			wantErr:   auth.ErrForbidden,
+		},
+		{
+			name:    "malformed ID",
+			req:     request.MarkNotificationsRequest{IDs: []string{"1"}},
+			wantErr: ErrValidation,
+		},
+		{
+			name:    "malformed before",
+			req:     request.MarkNotificationsRequest{Before: "yesterday"},
+			wantErr: ErrValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := newTestUseCase(notifications...)
+			principal := tt.principal
+			if principal == nil {
+				principal = auth.NewUserPrincipal(userID)
+			}
+
+			updated, err := uc.MarkNotifications(context.Background(), principal, &tt.req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MarkNotifications() = %v, want %v", err, tt.wantErr)
+			}
+			if updated != tt.want {
+				t.Fatalf("updated %d, want %d", updated, tt.want)
+			}
+			if err == nil && uc.repository.readAtKeys["user_id"] != principal.UserID.String() {
+				t.Fatalf("keys %v are not scoped to the caller", uc.repository.readAtKeys)
+			}
+			if err == nil && (uc.repository.readAt == nil) != tt.req.Unread {
+				t.Fatalf("read_at = %v with unread %v", uc.repository.readAt, tt.req.Unread)
+			}
+		})
+	}
+}
+
+func TestCreateNotification(t *testing.T) {
+	createdBy := uuid.New()
+	service := &auth.Principal{Role: auth.RoleService, Applications: []string{"MANPOWER"}}
+	valid := func() request.CreateNotificationRequest {
+		return request.CreateNotificationRequest{
+			Application: "MANPOWER",
+			Name:        "Approval",
+			URL:         "/approvals/1",
+			Message:     "Please approve",
+			UserIDs:     []string{uuid.NewString(), uuid.NewString()},
+			CreatedBy:   createdBy.String(),
+		}
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		modify    func(req *request.CreateNotificationRequest)
+		wantErr   error
+	}{
+		{name: "valid", modify: func(req *request.CreateNotificationRequest) {}},
+		{name: "no recipients", modify: func(req *request.CreateNotificationRequest) { req.UserIDs = nil }, wantErr: ErrValidation},
+		{name: "malformed created_by", modify: func(req *request.CreateNotificationRequest) { req.CreatedBy = "1" }, wantErr: ErrValidation},
+		{
+			name:    "one malformed recipient writes nothing",
+			modify:  func(req *request.CreateNotificationRequest) { req.UserIDs = append(req.UserIDs, "1") },
+			wantErr: ErrValidation,
+		},
+		{
+			name:      "service of another application",
+			principal: &auth.Principal{Role: auth.RoleService, Applications: []string{"RECRUITMENT"}},
+			modify:    func(req *request.CreateNotificationRequest) {},
+			wantErr:   auth.ErrForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := newTestUseCase()
+			principal := tt.principal
+			if principal == nil {
+				principal = service
+			}
+			req := valid()
+			tt.modify(&req)
+
+			res, err := uc.CreateNotification(context.Background(), principal, &req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateNotification() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(uc.repository.created) != 0 || len(uc.backplane.types()) != 0 {
+					t.Fatalf("a rejected request wrote %d batches and broadcast %v", len(uc.repository.created), uc.backplane.types())
+				}
+				return
+			}
+
+			if len(uc.repository.created) != 1 || len(res.IDs) != len(req.UserIDs) {
+				t.Fatalf("%d batches, IDs %v", len(uc.repository.created), res.IDs)
+			}
+			for i, id := range res.IDs {
+				if id != uc.repository.created[0][i].ID {
+					t.Fatalf("IDs %v do not match the created rows", res.IDs)
+				}
+			}
+			if types := uc.backplane.types(); len(types) != len(req.UserIDs) || types[0] != websocket.EventNotificationCreated {
+				t.Fatalf("broadcast %v", types)
+			}
+		})
+	}
+}
+
+func TestCreateNotificationIdempotencyKey(t *testing.T) {
+	createdBy := uuid.New()
+	original := []uuid.UUID{uuid.New(), uuid.New()}
+	uc := newTestUseCase()
+	uc.idempotency.keys = []entity.IdempotencyKey{{
+		Key:             "approval-1",
+		Application:     "MANPOWER",
+		CreatedBy:       createdBy,
+		NotificationIDs: original[0].String() + "," + original[1].String(),
+		ExpiresAt:       time.Now().Add(time.Hour),
+	}}
+
+	res, err := uc.CreateNotification(context.Background(), &auth.Principal{Role: auth.RoleService, Applications: []string{"MANPOWER"}}, &request.CreateNotificationRequest{
+		Application:    "MANPOWER",
+		UserIDs:        []string{uuid.NewString()},
+		CreatedBy:      createdBy.String(),
+		IdempotencyKey: "approval-1",
+	})
+	if err != nil {
+		t.Fatalf("CreateNotification: %v", err)
+	}
+	if len(res.IDs) != 2 || res.IDs[0] != original[0] || res.IDs[1] != original[1] {
+		t.Fatalf("IDs = %v, want the original %v", res.IDs, original)
+	}
+	if len(uc.repository.created) != 0 || len(uc.backplane.types()) != 0 {
+		t.Fatal("a repeated key created notifications again")
+	}
+}
+
+func TestNotificationsBySource(t *testing.T) {
+	userID := uuid.New()
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	linked := func(n int, sourceID string) entity.Notification {
+		notification := testNotification(n, userID, "MANPOWER", base)
+		notification.SourceType = "mpp_request"
+		notification.SourceID = sourceID
+		return notification
+	}
+	notifications := []entity.Notification{linked(1, "42"), linked(2, "42"), linked(3, "43")}
+	service := &auth.Principal{Role: auth.RoleService, Applications: []string{"MANPOWER"}}
+	source := &request.NotificationSourceRequest{Application: "MANPOWER", SourceType: "mpp_request", SourceID: "42"}
+
+	t.Run("mark read", func(t *testing.T) {
+		uc := newTestUseCase(notifications...)
+		updated, err := uc.MarkNotificationsReadBySource(context.Background(), service, source)
+		if err != nil || updated != 2 {
+			t.Fatalf("MarkNotificationsReadBySource() = %d, %v", updated, err)
+		}
+		if uc.repository.readAtKeys["source_id"] != "42" || uc.repository.readAt == nil {
+			t.Fatalf("keys %v, read_at %v", uc.repository.readAtKeys, uc.repository.readAt)
+		}
+	})
+
+	t.Run("retract", func(t *testing.T) {
+		uc := newTestUseCase(notifications...)
+		deleted, err := uc.DeleteNotificationsBySource(context.Background(), service, source)
+		if err != nil || deleted != 2 {
+			t.Fatalf("DeleteNotificationsBySource() = %d, %v", deleted, err)
+		}
+		if left := uc.repository.find(nil); len(left) != 1 || left[0].SourceID != "43" {
+			t.Fatalf("left %v", left)
+		}
+		if types := uc.backplane.types(); len(types) < 2 || types[0] != websocket.EventNotificationDeleted || types[1] != websocket.EventNotificationDeleted {
+			t.Fatalf("broadcast %v", types)
+		}
+	})
+
+	t.Run("service of another application", func(t *testing.T) {
+		uc := newTestUseCase(notifications...)
+		other := &auth.Principal{Role: auth.RoleService, Applications: []string{"RECRUITMENT"}}
+		if _, err := uc.DeleteNotificationsBySource(context.Background(), other, source); !errors.Is(err, auth.ErrForbidden) {
+			t.Fatalf("DeleteNotificationsBySource() = %v", err)
+		}
+		if _, err := uc.MarkNotificationsReadBySource(context.Background(), other, source); !errors.Is(err, auth.ErrForbidden) {
+			t.Fatalf("MarkNotificationsReadBySource() = %v", err)
+		}
+	})
+}
+
+func TestGetNotificationsByKeysIsScoped(t *testing.T) {
+	userID := uuid.New()
+	base := time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)
+	uc := newTestUseCase(
+		testNotification(1, userID, "MANPOWER", base),
+		testNotification(2, userID, "RECRUITMENT", base),
+		testNotification(3, uuid.New(), "MANPOWER", base),
+	)
+
+	notifications, total, err := uc.GetNotificationsByKeys(context.Background(), auth.NewUserPrincipal(userID), map[string]interface{}{"application": "MANPOWER"}, 1, 10, "", nil)
+	if err != nil || total != 1 || notifications[0].ID != testNotificationID(1) {
+		t.Fatalf("GetNotificationsByKeys() = %v, %d, %v", notifications, total, err)
+	}
+
+	_, _, err = uc.GetNotificationsByKeys(context.Background(), auth.NewUserPrincipal(userID), map[string]interface{}{"user_id": uuid.NewString()}, 1, 10, "", nil)
+	if !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("another user's notifications: %v", err)
+	}
+}
+
+func TestMarkNotificationRead(t *testing.T) {
+	userID := uuid.New()
+	notification := testNotification(1, userID, "MANPOWER", time.Now())
+
+	tests := []struct {
+		name    string
+		id      string
+		want    []string
+		wantErr error
+	}{
+		{name: "own notification", id: notification.ID.String(), want: []string{websocket.EventNotificationUpdated}},
+		{name: "malformed ID", id: "1", wantErr: auth.ErrNotFound},
+		{name: "unknown ID", id: uuid.NewString(), wantErr: auth.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := newTestUseCase(notification)
+			res, err := uc.MarkNotificationRead(context.Background(), auth.NewUserPrincipal(userID), tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MarkNotificationRead() = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && res.ReadAt == nil {
+				t.Fatal("read_at is not set")
+			}
+			// unread counts follow the updated event
+			if types := uc.backplane.types(); len(tt.want) > 0 && (len(types) == 0 || types[0] != tt.want[0]) {
+				t.Fatalf("broadcast %v, want %v first", types, tt.want)
+			} else if len(tt.want) == 0 && len(types) != 0 {
+				t.Fatalf("broadcast %v", types)
+			}
+		})
+	}
+
+	t.Run("another user's notification", func(t *testing.T) {
+		uc := newTestUseCase(notification)
+		if _, err := uc.MarkNotificationRead(context.Background(), auth.NewUserPrincipal(uuid.New()), notification.ID.String()); !errors.Is(err, auth.ErrNotFound) {
+			t.Fatalf("MarkNotificationRead() = %v", err)
+		}
+	})
+}
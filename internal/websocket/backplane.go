@@ -0,0 +1,122 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Backplane carries broadcasts between instances. Publish sends an envelope
+// to every instance, including this one, and each instance hands what it
+// receives to the deliver func passed to Subscribe.
+type Backplane interface {
+	Publish(envelope Envelope) error
+	Subscribe(deliver func(Envelope))
+}
+
+// LocalBackplane delivers in process. It is the default for single-node
+// deployments.
+type LocalBackplane struct {
+	deliver func(Envelope)
+	mu      sync.RWMutex
+}
+
+func NewLocalBackplane() *LocalBackplane {
+	return &LocalBackplane{}
+}
+
+func (b *LocalBackplane) Publish(envelope Envelope) error {
+	b.mu.RLock()
+	deliver := b.deliver
+	b.mu.RUnlock()
+
+	if deliver != nil {
+		deliver(envelope)
+	}
+	return nil
+}
+
+func (b *LocalBackplane) Subscribe(deliver func(Envelope)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deliver = deliver
+}
+
+// backplaneMessage is an Envelope on the wire, including the routing fields
+// the client never sees.
+type backplaneMessage struct {
+	Version     int             `json:"version"`
+	Type        string          `json:"type"`
+	ID          string          `json:"id"`
+	Ts          time.Time       `json:"ts"`
+	Data        json.RawMessage `json:"data"`
+	UserID      uuid.UUID       `json:"user_id"`
+	Application string          `json:"application"`
+}
+
+func MarshalBackplaneMessage(envelope Envelope) ([]byte, error) {
+	data, err := json.Marshal(envelope.Data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(backplaneMessage{
+		Version:     envelope.Version,
+		Type:        envelope.Type,
+		ID:          envelope.ID,
+		Ts:          envelope.Ts,
+		Data:        data,
+		UserID:      envelope.UserID,
+		Application: envelope.Application,
+	})
+}
+
+// UnmarshalBackplaneMessage restores the typed data of the envelope, so that
+// a remote envelope behaves like one broadcast locally.
+func UnmarshalBackplaneMessage(body []byte) (Envelope, error) {
+	var msg backplaneMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return Envelope{}, err
+	}
+
+	var data interface{}
+	var err error
+	switch msg.Type {
+	case EventNotificationCreated, EventNotificationUpdated:
+		var notification WsNotification
+		err = json.Unmarshal(msg.Data, &notification)
+		data = notification
+	case EventNotificationDeleted:
+		var deleted NotificationDeletedEvent
+		err = json.Unmarshal(msg.Data, &deleted)
+		data = deleted
+	case EventUnreadCountChanged:
+		var unreadCount UnreadCountEvent
+		err = json.Unmarshal(msg.Data, &unreadCount)
+		data = unreadCount
+	case EventUnreadCounts:
+		var unreadCounts UnreadCountsEvent
+		err = json.Unmarshal(msg.Data, &unreadCounts)
+		data = unreadCounts
+	case EventSystem:
+		var system SystemEvent
+		err = json.Unmarshal(msg.Data, &system)
+		data = system
+	default:
+		err = json.Unmarshal(msg.Data, &data)
+	}
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		Version:     msg.Version,
+		Type:        msg.Type,
+		ID:          msg.ID,
+		Ts:          msg.Ts,
+		Data:        data,
+		UserID:      msg.UserID,
+		Application: msg.Application,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBackplaneMessageRoundTrip(t *testing.T) {
+	userID := uuid.New()
+	notification := testNotification(userID, "mpp")
+	notification.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	for _, envelope := range []Envelope{
+		NewEnvelope(EventNotificationCreated, userID, "mpp", notification),
+		NewEnvelope(EventNotificationUpdated, userID, "mpp", notification),
+		NewEnvelope(EventNotificationDeleted, userID, "mpp", NotificationDeletedEvent{ID: notification.ID, UserID: userID, Application: "mpp"}),
+		NewEnvelope(EventUnreadCountChanged, userID, "mpp", UnreadCountEvent{UserID: userID, Application: "mpp", UnreadCount: 3}),
+		NewEnvelope(EventUnreadCounts, userID, "", UnreadCountsEvent{UserID: userID, Counts: map[string]int64{"mpp": 3}}),
+		NewEnvelope(EventSystem, uuid.Nil, "", SystemEvent{Message: "maintenance"}),
+		NewEnvelope(EventUnreadRefresh, userID, "", nil),
+	} {
+		t.Run(envelope.Type, func(t *testing.T) {
+			body, err := MarshalBackplaneMessage(envelope)
+			if err != nil {
+				t.Fatalf("MarshalBackplaneMessage: %v", err)
+			}
+			got, err := UnmarshalBackplaneMessage(body)
+			if err != nil {
+				t.Fatalf("UnmarshalBackplaneMessage: %v", err)
+			}
+			if !got.Ts.Equal(envelope.Ts) {
+				t.Fatalf("ts = %s, want %s", got.Ts, envelope.Ts)
+			}
+			got.Ts = envelope.Ts
+			if !reflect.DeepEqual(got, envelope) {
+				t.Fatalf("got %+v, want %+v", got, envelope)
+			}
+		})
+	}
+}
+
+func TestUnmarshalBackplaneMessageRejectsInvalidData(t *testing.T) {
+	for _, body := range []string{
+		`not json`,
+		`{"type":"notification_created","data":"not a notification"}`,
+		`{"type":"system","data":[1]}`,
+	} {
+		if _, err := UnmarshalBackplaneMessage([]byte(body)); err == nil {
+			t.Errorf("UnmarshalBackplaneMessage(%s) succeeded", body)
+		}
+	}
+}
+
+func TestLocalBackplaneDeliversToSubscriber(t *testing.T) {
+	backplane := NewLocalBackplane()
+	var delivered []Envelope
+	backplane.Subscribe(func(envelope Envelope) {
+		delivered = append(delivered, envelope)
+	})
+
+	envelope := NewEnvelope(EventSystem, uuid.Nil, "", SystemEvent{Message: "maintenance"})
+	if err := backplane.Publish(envelope); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if len(delivered) != 1 || delivered[0].ID != envelope.ID {
+		t.Fatalf("delivered %+v", delivered)
+	}
+}
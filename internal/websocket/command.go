@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CommandMarkRead         = "mark_read"
+	CommandMarkAllRead      = "mark_all_read"
+	CommandSubscribe        = "subscribe"
+	CommandUnsubscribe      = "unsubscribe"
+	CommandSetSubscriptions = "set_subscriptions"
+	CommandAck              = "ack"
+)
+
+const EventCommandResult = "command_result"
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+// ErrSubscribedToAll answers an unsubscribe from a client that receives every
+// application.
+var ErrSubscribedToAll = errors.New("subscribed to every application, use set_subscriptions to narrow down")
+
+// Command is a frame sent by the client. RequestID is echoed in the reply so
+// the client can match it to the call.
+type Command struct {
+	Type      string          `json:"type"`
+	RequestID string          `json:"request_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// CommandResult is the data of a command_result envelope.
+type CommandResult struct {
+	RequestID string      `json:"request_id"`
+	Command   string      `json:"command"`
+	Status    string      `json:"status"`
+	Error     string      `json:"error,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// CommandHandler runs the commands that need the notification use case. It is
+// created per connection so it can act as the authenticated user.
+type CommandHandler interface {
+	HandleCommand(client *Client, cmd Command) (interface{}, error)
+}
+
+type ackCommand struct {
+	ID string `json:"id"`
+}
+
+// handleCommand answers ack itself and passes the rest on to the
+// connection's CommandHandler.
+func (c *Client) handleCommand(cmd Command) (interface{}, error) {
+	if cmd.Type == CommandAck {
+		var data ackCommand
+		if err := decodeCommandData(cmd, &data); err != nil {
+			return nil, err
+		}
+		if data.ID == "" {
+			return nil, errors.New("id is required")
+		}
+		if _, err := uuid.Parse(data.ID); err != nil {
+			return nil, errors.New("id must be an event ID")
+		}
+		c.ack(data.ID)
+		return nil, nil
+	}
+
+	if c.commands == nil {
+		return nil, ErrUnknownCommand
+	}
+	return c.commands.HandleCommand(c, cmd)
+}
+
+func (c *Client) replyCommand(cmd Command, data interface{}, err error) {
+	result := CommandResult{
+		RequestID: cmd.RequestID,
+		Command:   cmd.Type,
+		Status:    "success",
+		Data:      data,
+	}
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+	}
+	c.send(NewEnvelope(EventCommandResult, c.UserID, "", result))
+}
+
+func decodeCommandData(cmd Command, target interface{}) error {
+	if len(cmd.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(cmd.Data, target)
+}
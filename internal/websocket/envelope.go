@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EnvelopeVersion is bumped whenever the shape of Envelope or of an event's
+// data changes incompatibly.
+const EnvelopeVersion = 1
+
+const (
+	EventNotificationCreated = "notification_created"
+	EventNotificationUpdated = "notification_updated"
+	EventNotificationDeleted = "notification_deleted"
+	EventUnreadCountChanged  = "unread_count_changed"
+	EventUnreadCounts        = "unread_counts" // per-application counts sent on connect
+	EventSystem              = "system"
+	EventUnreadRefresh       = "unread_refresh" // events were dropped, refetch unread counts
+)
+
+// Envelope is the frame written to every socket. Data depends on Type:
+// WsNotification for notification_created and notification_updated,
+// NotificationDeletedEvent, UnreadCountEvent, UnreadCountsEvent or SystemEvent,
+// and nothing for unread_refresh.
+type Envelope struct {
+	Version int         `json:"version"`
+	Type    string      `json:"type"`
+	ID      string      `json:"id"`
+	Ts      time.Time   `json:"ts"`
+	Data    interface{} `json:"data"`
+
+	// routing only; a nil UserID reaches every user and an empty Application
+	// every app type
+	UserID      uuid.UUID `json:"-"`
+	Application string    `json:"-"`
+}
+
+type UnreadCountEvent struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Application string    `json:"application"`
+	UnreadCount int64     `json:"unread_count"`
+}
+
+type UnreadCountsEvent struct {
+	UserID uuid.UUID        `json:"user_id"`
+	Counts map[string]int64 `json:"counts"` // by application
+}
+
+type NotificationDeletedEvent struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      uuid.UUID `json:"user_id"`
+	Application string    `json:"application"`
+}
+
+type SystemEvent struct {
+	Message string `json:"message"`
+}
+
+func NewEnvelope(eventType string, userID uuid.UUID, application string, data interface{}) Envelope {
+	return Envelope{
+		Version:     EnvelopeVersion,
+		Type:        eventType,
+		ID:          uuid.New().String(),
+		Ts:          time.Now(),
+		Data:        data,
+		UserID:      userID,
+		Application: application,
+	}
+}
+
+// Legacy converts the envelope to the bare WsNotification that clients
+// written before the envelope expect. Those clients treat every frame as a
+// new notification, so every other event reports false and is not sent.
+func (e Envelope) Legacy() (WsNotification, bool) {
+	notification, ok := e.Data.(WsNotification)
+	if !ok || e.Type != EventNotificationCreated {
+		return WsNotification{}, false
+	}
+	return notification, true
+}
@@ -1,10 +1,16 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"hash/fnv"
 	"log"
+	"net"
 	"net/http"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,23 +23,150 @@ var (
 )
 
 type Client struct {
-	ID      string
-	Conn    *websocket.Conn
-	UserID  uuid.UUID
-	Send    chan WsNotification
-	AppType string
+	ID     string
+	Conn   *websocket.Conn
+	UserID uuid.UUID
+	Send   chan Envelope
+	Legacy bool // write bare WsNotification frames instead of envelopes
+
+	hub           *Hub
+	commands      CommandHandler
+	unreadCounts  UnreadCountsFunc
+	all           bool            // receives every application, subscriptions is ignored
+	subscriptions map[string]bool // the applications received when not all
+	lastAck       string
+	policy        OverflowPolicy
+	refresh       chan struct{} // signalled when coalesced events need an unread_refresh
+	ctx           context.Context
+	cancel        context.CancelFunc
+	closed        bool
+	reapOnce      sync.Once
+	mu            sync.Mutex
+}
+
+// OverflowPolicy decides what happens when a client's Send buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowDisconnect closes the slow client, it can resume with replay.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowDropOldest discards the oldest queued event to make room.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowCoalesce discards the event and later tells the client to
+	// refresh its unread counts once.
+	OverflowCoalesce OverflowPolicy = "coalesce"
+)
+
+func ParseOverflowPolicy(value string) (OverflowPolicy, bool) {
+	switch policy := OverflowPolicy(value); policy {
+	case OverflowDisconnect, OverflowDropOldest, OverflowCoalesce:
+		return policy, true
+	default:
+		return "", false
+	}
 }
 
+// ClientOptions are chosen by the client when it connects.
+type ClientOptions struct {
+	Applications []string // empty subscribes to every application
+	Legacy       bool
+	Commands     CommandHandler
+	Replay       ReplayFunc
+	UnreadCounts UnreadCountsFunc
+	Policy       OverflowPolicy // empty uses the hub's default
+}
+
+// UnreadCountsFunc loads the unread count of each application, or of every
+// application when the list is empty.
+type UnreadCountsFunc func(ctx context.Context, applications []string) (map[string]int64, error)
+
+// ReplayFunc loads the notifications a reconnecting client missed, oldest
+// first, and reports whether the list was truncated.
+type ReplayFunc func(ctx context.Context) ([]WsNotification, bool, error)
+
 type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan WsNotification
-	register   chan *Client
-	unregister chan *Client
-	mu         sync.Mutex
+	shards      [hubShardCount]*hubShard
+	connections int64
+	broadcast   chan Envelope
+	backplane   Backplane
+	options     HubOptions
+	metrics     hubMetrics
 }
 
-// WsNotification matches the Notification entity structure
+// hubShardCount spreads users over independently locked shards, so that
+// registering a client does not contend with delivery to other users.
+const hubShardCount = 32
+
+// hubShard indexes the clients of the users hashed to it by user ID, and
+// remembers the last event each of those users acknowledged.
+type hubShard struct {
+	users    map[uuid.UUID]map[*Client]struct{}
+	lastAcks map[uuid.UUID]string
+	mu       sync.RWMutex
+}
+
+const (
+	defaultPongWait        = 60 * time.Second
+	defaultWriteWait       = 10 * time.Second
+	defaultMaxMessageSize  = 8192
+	defaultBroadcastBuffer = 1024
+	clientSendBuffer       = 256
+)
+
+// HubOptions tune the heartbeat and buffering of every client. Zero values
+// fall back to the defaults; PingInterval defaults to nine tenths of PongWait.
+type HubOptions struct {
+	PingInterval    time.Duration
+	PongWait        time.Duration
+	WriteWait       time.Duration
+	MaxMessageSize  int64
+	BroadcastBuffer int
+	OverflowPolicy  OverflowPolicy
+}
+
+func (o HubOptions) withDefaults() HubOptions {
+	if o.PongWait <= 0 {
+		o.PongWait = defaultPongWait
+	}
+	if o.PingInterval <= 0 || o.PingInterval >= o.PongWait {
+		o.PingInterval = o.PongWait * 9 / 10
+	}
+	if o.WriteWait <= 0 {
+		o.WriteWait = defaultWriteWait
+	}
+	if o.MaxMessageSize <= 0 {
+		o.MaxMessageSize = defaultMaxMessageSize
+	}
+	if o.BroadcastBuffer <= 0 {
+		o.BroadcastBuffer = defaultBroadcastBuffer
+	}
+	if _, ok := ParseOverflowPolicy(string(o.OverflowPolicy)); !ok {
+		o.OverflowPolicy = OverflowDisconnect
+	}
+	return o
+}
+
+type hubMetrics struct {
+	reaped              uint64
+	broadcastDropped    uint64
+	clientEventsDropped uint64
+	clientsDisconnected uint64
+}
+
+// HubMetrics is reported by the metrics endpoint.
+type HubMetrics struct {
+	Connections         int    `json:"connections"`
+	ReapedClients       uint64 `json:"reaped_clients"`        // clients dropped for missing heartbeats
+	BroadcastQueued     int    `json:"broadcast_queued"`      // envelopes waiting for the hub loop
+	BroadcastDropped    uint64 `json:"broadcast_dropped"`     // envelopes dropped because the hub queue was full
+	ClientEventsDropped uint64 `json:"client_events_dropped"` // events dropped or coalesced for slow clients
+	ClientsDisconnected uint64 `json:"clients_disconnected"`  // slow clients closed by the disconnect policy
+}
+
+// WsNotification matches the Notification entity structure. Type is only
+// meaningful for legacy clients, which receive it without an envelope.
 type WsNotification struct {
+	Type          string     `json:"type"`
 	ID            uuid.UUID  `json:"id"`
 	Application   string     `json:"application"`
 	Name          string     `json:"name"`
@@ -45,6 +178,8 @@ type WsNotification struct {
 	UserName      string     `json:"user_name"`
 	UnreadCount   int64      `json:"unread_count"`
 	CreatedByName string     `json:"created_by_name"`
+	SourceType    string     `json:"source_type"`
+	SourceID      string     `json:"source_id"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
 }
@@ -57,119 +192,559 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func GetHub() *Hub {
-	once.Do(func() {
-		HubInstance = &Hub{
-			broadcast:  make(chan WsNotification),
-			register:   make(chan *Client),
-			unregister: make(chan *Client),
-			clients:    make(map[*Client]bool),
+func NewHub(backplane Backplane, options HubOptions) *Hub {
+	options = options.withDefaults()
+	hub := &Hub{
+		broadcast: make(chan Envelope, options.BroadcastBuffer),
+		backplane: backplane,
+		options:   options,
+	}
+	for i := range hub.shards {
+		hub.shards[i] = &hubShard{
+			users:    make(map[uuid.UUID]map[*Client]struct{}),
+			lastAcks: make(map[uuid.UUID]string),
 		}
-		go HubInstance.Run()
+	}
+	backplane.Subscribe(hub.deliver)
+	go hub.Run()
+	return hub
+}
+
+// InitHub creates the shared hub on top of backplane. It must run before the
+// first GetHub call to take effect.
+func InitHub(backplane Backplane, options HubOptions) *Hub {
+	once.Do(func() {
+		HubInstance = NewHub(backplane, options)
 	})
 	return HubInstance
 }
 
+// GetHub returns the shared hub, delivering in process with the default
+// options unless InitHub was called first.
+func GetHub() *Hub {
+	return InitHub(NewLocalBackplane(), HubOptions{})
+}
+
+func (h *Hub) Metrics() HubMetrics {
+	return HubMetrics{
+		Connections:         int(atomic.LoadInt64(&h.connections)),
+		ReapedClients:       atomic.LoadUint64(&h.metrics.reaped),
+		BroadcastQueued:     len(h.broadcast),
+		BroadcastDropped:    atomic.LoadUint64(&h.metrics.broadcastDropped),
+		ClientEventsDropped: atomic.LoadUint64(&h.metrics.clientEventsDropped),
+		ClientsDisconnected: atomic.LoadUint64(&h.metrics.clientsDisconnected),
+	}
+}
+
+// Run delivers queued envelopes in order. An envelope for one user only
+// touches that user's clients; one without a user visits every shard.
 func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.mu.Lock()
-			h.clients[client] = true
-			h.mu.Unlock()
-
-		case client := <-h.unregister:
-			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.Send)
-			}
-			h.mu.Unlock()
-
-		case notification := <-h.broadcast:
-			h.mu.Lock()
-			for client := range h.clients {
-				if client.UserID == notification.UserID &&
-					(notification.Application == "" || client.AppType == notification.Application) {
-					select {
-					case client.Send <- notification:
-					default:
-						log.Printf("error: client send channel is full")
-						close(client.Send)
-						delete(h.clients, client)
-					}
-				}
-			}
-			h.mu.Unlock()
+	for envelope := range h.broadcast {
+		if envelope.UserID != uuid.Nil {
+			h.dispatch(h.shardFor(envelope.UserID), envelope)
+			continue
+		}
+		for _, shard := range h.shards {
+			h.dispatch(shard, envelope)
 		}
 	}
 }
 
+func (h *Hub) dispatch(shard *hubShard, envelope Envelope) {
+	var slow []*Client
+
+	shard.mu.RLock()
+	if envelope.UserID != uuid.Nil {
+		slow = h.sendAll(shard.users[envelope.UserID], envelope, slow)
+	} else {
+		for _, clients := range shard.users {
+			slow = h.sendAll(clients, envelope, slow)
+		}
+	}
+	shard.mu.RUnlock()
+
+	for _, client := range slow {
+		log.Printf("error: client %s send channel is full, disconnecting", client.ID)
+		atomic.AddUint64(&h.metrics.clientsDisconnected, 1)
+		h.unregisterClient(client)
+	}
+}
+
+// sendAll returns slow with the clients appended that must be disconnected.
+func (h *Hub) sendAll(clients map[*Client]struct{}, envelope Envelope, slow []*Client) []*Client {
+	for client := range clients {
+		if envelope.Application != "" && !client.IsSubscribed(envelope.Application) {
+			continue
+		}
+		if !client.send(envelope) {
+			slow = append(slow, client)
+		}
+	}
+	return slow
+}
+
+func (h *Hub) shardFor(userID uuid.UUID) *hubShard {
+	hash := fnv.New32a()
+	hash.Write(userID[:])
+	return h.shards[hash.Sum32()%hubShardCount]
+}
+
+func (h *Hub) registerClient(client *Client) {
+	shard := h.shardFor(client.UserID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	clients, ok := shard.users[client.UserID]
+	if !ok {
+		clients = make(map[*Client]struct{})
+		shard.users[client.UserID] = clients
+	}
+	clients[client] = struct{}{}
+	atomic.AddInt64(&h.connections, 1)
+}
+
+// unregisterClient removes client from the index and closes its Send
+// channel. It is safe to call more than once.
+func (h *Hub) unregisterClient(client *Client) {
+	shard := h.shardFor(client.UserID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	clients, ok := shard.users[client.UserID]
+	if !ok {
+		return
+	}
+	if _, ok := clients[client]; !ok {
+		return
+	}
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(shard.users, client.UserID)
+	}
+	atomic.AddInt64(&h.connections, -1)
+	client.close()
+}
+
+// LastAck is the ID of the last event any of the user's sockets on this
+// instance acknowledged, so a reconnect can resume from it.
+func (h *Hub) LastAck(userID uuid.UUID) string {
+	shard := h.shardFor(userID)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	return shard.lastAcks[userID]
+}
+
+func (h *Hub) rememberAck(userID uuid.UUID, id string) {
+	shard := h.shardFor(userID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.lastAcks[userID] = id
+}
+
+// Broadcast publishes envelope on the backplane so that every instance
+// delivers it to its own clients. If the backplane is unavailable the local
+// clients still get it.
+func (h *Hub) Broadcast(envelope Envelope) {
+	if err := h.backplane.Publish(envelope); err != nil {
+		log.Printf("error: failed to publish to backplane, delivering locally: %v", err)
+		h.deliver(envelope)
+	}
+}
+
+// deliver never blocks the caller. When the hub loop falls behind and its
+// queue is full the envelope is dropped and counted; clients recover it
+// through replay.
+func (h *Hub) deliver(envelope Envelope) {
+	select {
+	case h.broadcast <- envelope:
+	default:
+		atomic.AddUint64(&h.metrics.broadcastDropped, 1)
+		log.Printf("error: hub broadcast queue is full, dropping %s event %s", envelope.Type, envelope.ID)
+	}
+}
+
+// BroadcastNotification sends a notification_created event. The envelope ID is
+// the notification ID, so clients can de-duplicate.
 func (h *Hub) BroadcastNotification(notification WsNotification) {
-	h.broadcast <- notification
+	notification.Type = EventNotificationCreated
+	envelope := NewEnvelope(EventNotificationCreated, notification.UserID, notification.Application, notification)
+	envelope.ID = notification.ID.String()
+	h.Broadcast(envelope)
+}
+
+func (h *Hub) BroadcastNotificationUpdated(notification WsNotification) {
+	notification.Type = EventNotificationUpdated
+	h.Broadcast(NewEnvelope(EventNotificationUpdated, notification.UserID, notification.Application, notification))
+}
+
+func (h *Hub) BroadcastNotificationDeleted(id uuid.UUID, userID uuid.UUID, application string) {
+	h.Broadcast(NewEnvelope(EventNotificationDeleted, userID, application, NotificationDeletedEvent{
+		ID:          id,
+		UserID:      userID,
+		Application: application,
+	}))
+}
+
+// BroadcastUnreadCount sends an unread_count_changed event to every socket the
+// user has open for application.
+func (h *Hub) BroadcastUnreadCount(userID uuid.UUID, application string, unreadCount int64) {
+	h.Broadcast(NewEnvelope(EventUnreadCountChanged, userID, application, UnreadCountEvent{
+		UserID:      userID,
+		Application: application,
+		UnreadCount: unreadCount,
+	}))
+}
+
+// BroadcastSystemMessage reaches every connected client.
+func (h *Hub) BroadcastSystemMessage(message string) {
+	h.Broadcast(NewEnvelope(EventSystem, uuid.Nil, "", SystemEvent{Message: message}))
 }
 
+// readPump expects a pong or a frame within PongWait. A client that stays
+// silent longer is treated as a dead connection and reaped.
 func (c *Client) readPump() {
 	defer func() {
-		GetHub().unregister <- c
+		c.hub.unregisterClient(c)
 		c.Conn.Close()
 	}()
 
+	options := c.hub.options
+	c.Conn.SetReadLimit(options.MaxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(options.PongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		return c.Conn.SetReadDeadline(time.Now().Add(options.PongWait))
+	})
+
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		_, message, err := c.Conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				c.reap("missed heartbeat")
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
 			}
 			break
 		}
+		c.Conn.SetReadDeadline(time.Now().Add(options.PongWait))
+
+		var cmd Command
+		if err := json.Unmarshal(message, &cmd); err != nil {
+			c.replyCommand(cmd, nil, errors.New("invalid command format"))
+			continue
+		}
+		data, err := c.handleCommand(cmd)
+		c.replyCommand(cmd, data, err)
+	}
+}
+
+// send queues envelope without blocking, applying the client's overflow
+// policy when the buffer is full. It reports false when the client should be
+// disconnected or is already closed.
+func (c *Client) send(envelope Envelope) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- envelope:
+		return true
+	default:
+	}
+
+	switch c.policy {
+	case OverflowDropOldest:
+		select {
+		case <-c.Send:
+		default:
+		}
+		atomic.AddUint64(&c.hub.metrics.clientEventsDropped, 1)
+		select {
+		case c.Send <- envelope:
+		default:
+		}
+		return true
+	case OverflowCoalesce:
+		atomic.AddUint64(&c.hub.metrics.clientEventsDropped, 1)
+		select {
+		case c.refresh <- struct{}{}:
+		default:
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// reap counts a dead connection once and closes it, which also stops the
+// other pump.
+func (c *Client) reap(reason string) {
+	c.reapOnce.Do(func() {
+		atomic.AddUint64(&c.hub.metrics.reaped, 1)
+		log.Printf("info: reaping websocket client %s: %s", c.ID, reason)
+		c.Conn.Close()
+	})
+}
+
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+		c.cancel()
 	}
 }
 
-func (c *Client) writePump() {
+// Context is cancelled once the connection is closed, so that lookups made on
+// behalf of the client stop with it.
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
+// IsSubscribed reports whether events of application reach the client.
+func (c *Client) IsSubscribed(application string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.all || c.subscriptions[application]
+}
+
+// SubscribedToAll reports whether the client receives every application,
+// which is the case until it narrows its subscriptions with
+// SetSubscriptions.
+func (c *Client) SubscribedToAll() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.all
+}
+
+// Subscriptions returns the subscribed applications in sorted order, or nil
+// when the client receives every application. A client subscribed to nothing
+// gets an empty slice.
+func (c *Client) Subscriptions() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.all {
+		return nil
+	}
+	applications := make([]string, 0, len(c.subscriptions))
+	for application := range c.subscriptions {
+		applications = append(applications, application)
+	}
+	sort.Strings(applications)
+	return applications
+}
+
+// Subscribe adds application to the subscriptions. A client receiving every
+// application already receives it and keeps receiving everything.
+func (c *Client) Subscribe(application string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.all {
+		return
+	}
+	c.subscriptions[application] = true
+}
+
+// Unsubscribe removes application from the subscriptions; after the last one
+// the client receives nothing. A client receiving every application has no
+// list to remove it from and must narrow down with SetSubscriptions instead.
+func (c *Client) Unsubscribe(application string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.all {
+		return ErrSubscribedToAll
+	}
+	delete(c.subscriptions, application)
+	return nil
+}
+
+// SetSubscriptions replaces the subscribed applications. An empty list
+// subscribes to every application; to receive nothing, unsubscribe from the
+// last application instead.
+func (c *Client) SetSubscriptions(applications []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.all = len(applications) == 0
+	c.subscriptions = make(map[string]bool, len(applications))
+	for _, application := range applications {
+		c.subscriptions[application] = true
+	}
+}
+
+// LastAck is the ID of the last event the client acknowledged.
+func (c *Client) LastAck() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastAck
+}
+
+func (c *Client) ack(id string) {
+	c.mu.Lock()
+	c.lastAck = id
+	c.mu.Unlock()
+	c.hub.rememberAck(c.UserID, id)
+}
+
+// writePump writes the replay, if any, before the first live event. Live
+// events queue up in Send meanwhile, and those already replayed are skipped.
+func (c *Client) writePump(replay ReplayFunc) {
+	ticker := time.NewTicker(c.hub.options.PingInterval)
 	defer func() {
+		ticker.Stop()
 		c.Conn.Close()
 	}()
 
+	replayed, err := c.writeReplay(replay)
+	if err != nil {
+		return
+	}
+	if err := c.writeUnreadCounts(); err != nil {
+		return
+	}
+
 	for {
 		select {
-		case notification, ok := <-c.Send:
+		case <-ticker.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(c.hub.options.WriteWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.reap("ping failed")
+				return
+			}
+		case <-c.refresh:
+			// events were coalesced, the client refetches its unread counts
+			if err := c.write(NewEnvelope(EventUnreadRefresh, c.UserID, "", nil)); err != nil {
+				return
+			}
+		case envelope, ok := <-c.Send:
 			if !ok {
+				c.Conn.SetWriteDeadline(time.Now().Add(c.hub.options.WriteWait))
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+			if envelope.Type == EventNotificationCreated && replayed[envelope.ID] {
+				continue
 			}
 
-			json.NewEncoder(w).Encode(notification)
-
-			if err := w.Close(); err != nil {
+			if err := c.write(envelope); err != nil {
 				return
 			}
 		}
 	}
 }
 
-func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, userID uuid.UUID, appType string) {
+func (c *Client) writeReplay(replay ReplayFunc) (map[string]bool, error) {
+	replayed := make(map[string]bool)
+	if replay == nil {
+		return replayed, nil
+	}
+
+	notifications, truncated, err := replay(c.ctx)
+	if err != nil {
+		log.Printf("error: failed to replay notifications: %v", err)
+		return replayed, c.write(NewEnvelope(EventSystem, c.UserID, "", SystemEvent{Message: "replay failed, reload notifications"}))
+	}
+
+	for _, notification := range notifications {
+		notification.Type = EventNotificationCreated
+		envelope := NewEnvelope(EventNotificationCreated, notification.UserID, notification.Application, notification)
+		envelope.ID = notification.ID.String()
+		if err := c.write(envelope); err != nil {
+			return nil, err
+		}
+		replayed[envelope.ID] = true
+	}
+
+	if truncated {
+		return replayed, c.write(NewEnvelope(EventSystem, c.UserID, "", SystemEvent{Message: "replay truncated, reload notifications"}))
+	}
+	return replayed, nil
+}
+
+// writeUnreadCounts sends the badge of every subscribed application once the
+// client is connected.
+func (c *Client) writeUnreadCounts() error {
+	if c.unreadCounts == nil {
+		return nil
+	}
+
+	counts := map[string]int64{}
+	var err error
+	if applications := c.Subscriptions(); c.SubscribedToAll() || len(applications) > 0 {
+		counts, err = c.unreadCounts(c.ctx, applications)
+	}
+	if err != nil {
+		log.Printf("error: failed to load unread counts: %v", err)
+		return nil
+	}
+	return c.write(NewEnvelope(EventUnreadCounts, c.UserID, "", UnreadCountsEvent{
+		UserID: c.UserID,
+		Counts: counts,
+	}))
+}
+
+func (c *Client) write(envelope Envelope) error {
+	var frame interface{} = envelope
+	if c.Legacy {
+		notification, ok := envelope.Legacy()
+		if !ok {
+			return nil
+		}
+		frame = notification
+	}
+
+	c.Conn.SetWriteDeadline(time.Now().Add(c.hub.options.WriteWait))
+	w, err := c.Conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+
+	json.NewEncoder(w).Encode(frame)
+
+	return w.Close()
+}
+
+func newClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID, opts ClientOptions) *Client {
+	client := &Client{
+		ID:           uuid.New().String(),
+		Conn:         conn,
+		hub:          hub,
+		UserID:       userID,
+		Send:         make(chan Envelope, clientSendBuffer),
+		Legacy:       opts.Legacy,
+		policy:       hub.options.OverflowPolicy,
+		refresh:      make(chan struct{}, 1),
+		commands:     opts.Commands,
+		unreadCounts: opts.UnreadCounts,
+	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	client.SetSubscriptions(opts.Applications)
+	if opts.Policy != "" {
+		client.policy = opts.Policy
+	}
+	return client
+}
+
+func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request, userID uuid.UUID, opts ClientOptions) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	client := &Client{
-		ID:      uuid.New().String(),
-		Conn:    conn,
-		UserID:  userID,
-		Send:    make(chan WsNotification, 256),
-		AppType: appType,
-	}
+	client := newClient(hub, conn, userID, opts)
 
-	hub.register <- client
+	// register before replaying, so that nothing created meanwhile is missed
+	hub.registerClient(client)
 
-	go client.writePump()
+	go client.writePump(opts.Replay)
 	go client.readPump()
 }
@@ -0,0 +1,377 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func newTestHub(options HubOptions) *Hub {
+	return NewHub(NewLocalBackplane(), options)
+}
+
+// connectTestClient registers a client without a network connection; what the
+// hub sends it can be read from its Send channel.
+func connectTestClient(hub *Hub, userID uuid.UUID, opts ClientOptions) *Client {
+	client := newClient(hub, nil, userID, opts)
+	hub.registerClient(client)
+	return client
+}
+
+func receive(t *testing.T, client *Client) Envelope {
+	t.Helper()
+	select {
+	case envelope, ok := <-client.Send:
+		if !ok {
+			t.Fatal("client was disconnected")
+		}
+		return envelope
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Envelope{}
+	}
+}
+
+// expectNothingBefore asserts that the next event the client receives is the
+// system message broadcast after everything else.
+func expectNothingBefore(t *testing.T, hub *Hub, client *Client) {
+	t.Helper()
+	hub.BroadcastSystemMessage("marker")
+	if envelope := receive(t, client); envelope.Type != EventSystem {
+		t.Fatalf("unexpected %s event for %s", envelope.Type, envelope.Application)
+	}
+}
+
+func testNotification(userID uuid.UUID, application string) WsNotification {
+	return WsNotification{ID: uuid.New(), UserID: userID, Application: application, Name: "Approval", Message: "Please approve"}
+}
+
+func TestClientWithoutSubscriptionsReceivesEveryApplication(t *testing.T) {
+	hub := newTestHub(HubOptions{})
+	userID := uuid.New()
+	client := connectTestClient(hub, userID, ClientOptions{})
+
+	for _, application := range []string{"mpp", "recruitment"} {
+		hub.BroadcastNotification(testNotification(userID, application))
+		if envelope := receive(t, client); envelope.Application != application {
+			t.Fatalf("application = %s, want %s", envelope.Application, application)
+		}
+	}
+}
+
+func TestClientReceivesOnlySubscribedApplications(t *testing.T) {
+	hub := newTestHub(HubOptions{})
+	userID := uuid.New()
+	client := connectTestClient(hub, userID, ClientOptions{Applications: []string{"mpp"}})
+	other := connectTestClient(hub, uuid.New(), ClientOptions{})
+
+	hub.BroadcastNotification(testNotification(userID, "recruitment"))
+	hub.BroadcastNotification(testNotification(userID, "mpp"))
+
+	if envelope := receive(t, client); envelope.Application != "mpp" || envelope.Type != EventNotificationCreated {
+		t.Fatalf("received %s for %s", envelope.Type, envelope.Application)
+	}
+	expectNothingBefore(t, hub, client)
+	// events of one user never reach another
+	expectNothingBefore(t, hub, other)
+}
+
+func TestHandleAckCommand(t *testing.T) {
+	hub := newTestHub(HubOptions{})
+	client := newClient(hub, nil, uuid.New(), ClientOptions{})
+
+	id := uuid.NewString()
+	data, _ := json.Marshal(ackCommand{ID: id})
+	if _, err := client.handleCommand(Command{Type: CommandAck, Data: data}); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if client.LastAck() != id {
+		t.Fatalf("LastAck() = %q", client.LastAck())
+	}
+	// the hub keeps it for the next connection of the user
+	if hub.LastAck(client.UserID) != id {
+		t.Fatalf("hub.LastAck() = %q", hub.LastAck(client.UserID))
+	}
+
+	if _, err := client.handleCommand(Command{Type: CommandAck}); err == nil {
+		t.Fatal("ack without id should fail")
+	}
+	data, _ = json.Marshal(ackCommand{ID: "event-1"})
+	if _, err := client.handleCommand(Command{Type: CommandAck, Data: data}); err == nil {
+		t.Fatal("ack of an unknown id format should fail")
+	}
+}
+
+type recordingCommandHandler struct {
+	commands []string
+}
+
+func (h *recordingCommandHandler) HandleCommand(client *Client, cmd Command) (interface{}, error) {
+	h.commands = append(h.commands, cmd.Type)
+	return "ok", nil
+}
+
+func TestHandleCommandDelegatesToHandler(t *testing.T) {
+	hub := newTestHub(HubOptions{})
+
+	client := newClient(hub, nil, uuid.New(), ClientOptions{})
+	if _, err := client.handleCommand(Command{Type: CommandMarkAllRead}); !errors.Is(err, ErrUnknownCommand) {
+		t.Fatalf("handleCommand() = %v, want ErrUnknownCommand", err)
+	}
+
+	handler := &recordingCommandHandler{}
+	client = newClient(hub, nil, uuid.New(), ClientOptions{Commands: handler})
+	if data, err := client.handleCommand(Command{Type: CommandMarkAllRead}); err != nil || data != "ok" {
+		t.Fatalf("handleCommand() = %v, %v", data, err)
+	}
+	if len(handler.commands) != 1 || handler.commands[0] != CommandMarkAllRead {
+		t.Fatalf("handled %v", handler.commands)
+	}
+}
+
+func TestLegacyOnlySendsCreatedNotifications(t *testing.T) {
+	userID := uuid.New()
+	notification := testNotification(userID, "mpp")
+
+	created := NewEnvelope(EventNotificationCreated, userID, "mpp", notification)
+	if legacy, ok := created.Legacy(); !ok || legacy.ID != notification.ID {
+		t.Fatalf("Legacy() = %+v, %v", legacy, ok)
+	}
+
+	for _, envelope := range []Envelope{
+		NewEnvelope(EventNotificationUpdated, userID, "mpp", notification),
+		NewEnvelope(EventUnreadCountChanged, userID, "mpp", UnreadCountEvent{UserID: userID, Application: "mpp", UnreadCount: 3}),
+		NewEnvelope(EventNotificationDeleted, userID, "mpp", NotificationDeletedEvent{ID: notification.ID}),
+		NewEnvelope(EventSystem, uuid.Nil, "", SystemEvent{Message: "maintenance"}),
+		NewEnvelope(EventUnreadRefresh, userID, "", nil),
+	} {
+		if _, ok := envelope.Legacy(); ok {
+			t.Errorf("%s must not reach legacy clients", envelope.Type)
+		}
+	}
+}
+
+// fillSendBuffer queues events until the client's Send buffer is full.
+func fillSendBuffer(t *testing.T, client *Client) {
+	t.Helper()
+	for i := 0; i < cap(client.Send); i++ {
+		if !client.send(NewEnvelope(EventSystem, client.UserID, "", SystemEvent{Message: "queued"})) {
+			t.Fatalf("send %d failed before the buffer was full", i)
+		}
+	}
+}
+
+func waitForMetrics(t *testing.T, hub *Hub, done func(HubMetrics) bool) HubMetrics {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		metrics := hub.Metrics()
+		if done(metrics) {
+			return metrics
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("metrics = %+v", metrics)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOverflowDisconnect(t *testing.T) {
+	hub := newTestHub(HubOptions{})
+	userID := uuid.New()
+	client := connectTestClient(hub, userID, ClientOptions{Policy: OverflowDisconnect})
+	fillSendBuffer(t, client)
+
+	hub.BroadcastNotification(testNotification(userID, "mpp"))
+	metrics := waitForMetrics(t, hub, func(m HubMetrics) bool { return m.ClientsDisconnected == 1 })
+	if metrics.Connections != 0 || metrics.ClientEventsDropped != 0 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+
+	// the queued events are still written before the channel reports closed
+	for i := 0; i < clientSendBuffer; i++ {
+		<-client.Send
+	}
+	if _, ok := <-client.Send; ok {
+		t.Fatal("Send is still open")
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	hub := newTestHub(HubOptions{OverflowPolicy: OverflowDropOldest})
+	userID := uuid.New()
+	client := connectTestClient(hub, userID, ClientOptions{})
+	fillSendBuffer(t, client)
+
+	notification := testNotification(userID, "mpp")
+	hub.BroadcastNotification(notification)
+	metrics := waitForMetrics(t, hub, func(m HubMetrics) bool { return m.ClientEventsDropped == 1 })
+	if metrics.Connections != 1 || metrics.ClientsDisconnected != 0 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+
+	var last Envelope
+	for i := 0; i < clientSendBuffer; i++ {
+		last = <-client.Send
+	}
+	if last.ID != notification.ID.String() {
+		t.Fatalf("newest event %s was not kept", last.Type)
+	}
+}
+
+func TestOverflowCoalesce(t *testing.T) {
+	hub := newTestHub(HubOptions{})
+	userID := uuid.New()
+	client := connectTestClient(hub, userID, ClientOptions{Policy: OverflowCoalesce})
+	fillSendBuffer(t, client)
+
+	hub.BroadcastNotification(testNotification(userID, "mpp"))
+	hub.BroadcastNotification(testNotification(userID, "mpp"))
+	metrics := waitForMetrics(t, hub, func(m HubMetrics) bool { return m.ClientEventsDropped == 2 })
+	if metrics.Connections != 1 || metrics.ClientsDisconnected != 0 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+
+	// both drops collapse into a single unread_refresh signal
+	if len(client.refresh) != 1 {
+		t.Fatalf("%d refresh signals pending, want 1", len(client.refresh))
+	}
+	if len(client.Send) != clientSendBuffer {
+		t.Fatalf("%d events queued", len(client.Send))
+	}
+}
+
+func TestUnsubscribingTheLastApplicationReceivesNothing(t *testing.T) {
+	hub := newTestHub(HubOptions{})
+	userID := uuid.New()
+	client := connectTestClient(hub, userID, ClientOptions{Applications: []string{"mpp"}})
+
+	if err := client.Unsubscribe("mpp"); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if client.SubscribedToAll() || client.Subscriptions() == nil || len(client.Subscriptions()) != 0 {
+		t.Fatalf("subscriptions = %v, want none", client.Subscriptions())
+	}
+	hub.BroadcastNotification(testNotification(userID, "mpp"))
+	hub.BroadcastNotification(testNotification(userID, "recruitment"))
+	expectNothingBefore(t, hub, client)
+
+	client.Subscribe("recruitment")
+	hub.BroadcastNotification(testNotification(userID, "mpp"))
+	hub.BroadcastNotification(testNotification(userID, "recruitment"))
+	if envelope := receive(t, client); envelope.Application != "recruitment" {
+		t.Fatalf("application = %s, want recruitment", envelope.Application)
+	}
+	expectNothingBefore(t, hub, client)
+}
+
+func TestSubscriptionsTrackEveryApplication(t *testing.T) {
+	client := newClient(newTestHub(HubOptions{}), nil, uuid.New(), ClientOptions{})
+	if !client.SubscribedToAll() || client.Subscriptions() != nil {
+		t.Fatalf("subscriptions = %v, want every application", client.Subscriptions())
+	}
+
+	// subscribing adds to every application, it does not narrow it down
+	client.Subscribe("mpp")
+	if !client.SubscribedToAll() || !client.IsSubscribed("mpp") || !client.IsSubscribed("recruitment") {
+		t.Fatalf("subscribe narrowed every application to %v", client.Subscriptions())
+	}
+
+	// there is no list to unsubscribe from
+	if err := client.Unsubscribe("mpp"); !errors.Is(err, ErrSubscribedToAll) {
+		t.Fatalf("Unsubscribe() = %v, want ErrSubscribedToAll", err)
+	}
+	if !client.SubscribedToAll() || !client.IsSubscribed("mpp") {
+		t.Fatal("a rejected unsubscribe changed the subscriptions")
+	}
+
+	client.SetSubscriptions([]string{"mpp"})
+	if client.SubscribedToAll() || !client.IsSubscribed("mpp") || client.IsSubscribed("recruitment") {
+		t.Fatalf("subscriptions = %v, want [mpp]", client.Subscriptions())
+	}
+
+	// the last unsubscribe leaves nothing, unlike an empty set
+	if err := client.Unsubscribe("mpp"); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+	if client.SubscribedToAll() || client.Subscriptions() == nil || client.IsSubscribed("mpp") {
+		t.Fatalf("subscriptions = %v, want none", client.Subscriptions())
+	}
+
+	client.SetSubscriptions(nil)
+	if !client.SubscribedToAll() || !client.IsSubscribed("recruitment") {
+		t.Fatal("an empty set should subscribe to every application")
+	}
+}
+
+const benchmarkConnections = 10000
+
+// newBenchmarkHub connects clients for as many users. Their Send buffers are
+// never drained, so drop_oldest keeps them connected once they fill up.
+func newBenchmarkHub(b *testing.B, users int) (*Hub, []uuid.UUID) {
+	b.Helper()
+	hub := newTestHub(HubOptions{OverflowPolicy: OverflowDropOldest})
+	userIDs := make([]uuid.UUID, users)
+	for i := range userIDs {
+		userIDs[i] = uuid.New()
+		connectTestClient(hub, userIDs[i], ClientOptions{})
+	}
+	return hub, userIDs
+}
+
+// flush waits until the hub has dispatched everything broadcast so far. The
+// hub dispatches in order, so a marker for a drained client comes last.
+func flush(hub *Hub, sentinel *Client) {
+	marker := NewEnvelope(EventSystem, sentinel.UserID, "", SystemEvent{Message: "flush"})
+	hub.Broadcast(marker)
+	for envelope := range sentinel.Send {
+		if envelope.ID == marker.ID {
+			return
+		}
+	}
+}
+
+func BenchmarkHubRegister(b *testing.B) {
+	hub, _ := newBenchmarkHub(b, benchmarkConnections)
+	clients := make([]*Client, b.N)
+	for i := range clients {
+		clients[i] = newClient(hub, nil, uuid.New(), ClientOptions{})
+	}
+
+	b.ResetTimer()
+	for _, client := range clients {
+		hub.registerClient(client)
+	}
+}
+
+func BenchmarkHubBroadcast(b *testing.B) {
+	hub, _ := newBenchmarkHub(b, benchmarkConnections)
+	sentinel := connectTestClient(hub, uuid.New(), ClientOptions{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hub.BroadcastSystemMessage("maintenance")
+		flush(hub, sentinel)
+	}
+}
+
+func BenchmarkHubBulkSend(b *testing.B) {
+	const recipients = 1000
+	hub, userIDs := newBenchmarkHub(b, benchmarkConnections)
+	sentinel := connectTestClient(hub, uuid.New(), ClientOptions{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, userID := range userIDs[:recipients] {
+			hub.BroadcastNotification(testNotification(userID, "mpp"))
+		}
+		flush(hub, sentinel)
+	}
+	b.StopTimer()
+	if dropped := hub.Metrics().BroadcastDropped; dropped > 0 {
+		b.Fatalf("%d envelopes dropped by the hub queue", dropped)
+	}
+}
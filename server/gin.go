@@ -1,6 +1,7 @@
 package server
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -9,9 +10,11 @@ import (
 
 	"github.com/IlhamSetiaji/julong-notification-be/config"
 	"github.com/IlhamSetiaji/julong-notification-be/database"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/auth"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/dto"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/handler"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/messaging"
+	"github.com/IlhamSetiaji/julong-notification-be/internal/middleware"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/rabbitmq"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/repository"
 	"github.com/IlhamSetiaji/julong-notification-be/internal/usecase"
@@ -25,18 +28,24 @@ import (
 	csrf "github.com/utrack/gin-csrf"
 )
 
+const defaultIdempotencyPurgeInterval = time.Hour
+
 type ginServer struct {
-	app       *gin.Engine
-	db        database.Database
-	conf      config.Config
-	log       logger.Logger
-	validator validator.Validator
+	app         *gin.Engine
+	db          database.Database
+	conf        config.Config
+	log         logger.Logger
+	validator   validator.Validator
+	amqp        *rabbitmq.ConnectionManager
+	deadLetter  *rabbitmq.DeadLetterQueue
+	userMessage *messaging.CachedUserMessage
+	backplane   *rabbitmq.FanoutBackplane // nil with the local backplane
 }
 
 func NewGinServer(db database.Database, conf config.Config, log logger.Logger, validator validator.Validator) Server {
 	app := gin.New()
 	app.Use(gin.Recovery())
-	app.Use(gin.Logger())
+	app.Use(gin.LoggerWithFormatter(logFormatter))
 
 	store := cookie.NewStore([]byte(conf.Session.Secret))
 	app.Use(sessions.Sessions(conf.Session.Name, store))
@@ -65,26 +74,62 @@ func NewGinServer(db database.Database, conf config.Config, log logger.Logger, v
 
 	// app.RedirectTrailingSlash = false
 
+	server := &ginServer{
+		app:       app,
+		db:        db,
+		conf:      conf,
+		log:       log,
+		validator: validator,
+		amqp:      rabbitmq.NewConnectionManager(conf, log),
+	}
+	server.deadLetter = rabbitmq.NewDeadLetterQueue(conf, log, server.amqp)
+
+	var backplane websocket.Backplane = websocket.NewLocalBackplane()
+	var hubOptions websocket.HubOptions
+	if conf.Websocket != nil {
+		if conf.Websocket.Backplane == "rabbitmq" {
+			fanoutBackplane := rabbitmq.NewFanoutBackplane(conf, log, server.amqp)
+			go fanoutBackplane.Run()
+			backplane = fanoutBackplane
+			server.backplane = fanoutBackplane
+		}
+		hubOptions = websocket.HubOptions{
+			PingInterval:    time.Duration(conf.Websocket.PingInterval) * time.Second,
+			PongWait:        time.Duration(conf.Websocket.PongWait) * time.Second,
+			WriteWait:       time.Duration(conf.Websocket.WriteWait) * time.Second,
+			MaxMessageSize:  conf.Websocket.MaxMessageSize,
+			BroadcastBuffer: conf.Websocket.BroadcastBuffer,
+			OverflowPolicy:  websocket.OverflowPolicy(conf.Websocket.OverflowPolicy),
+		}
+	}
+	websocket.InitHub(backplane, hubOptions)
+	server.userMessage = messaging.NewCachedUserMessage(log, conf, messaging.NewUserMessage(log, messaging.GetRPCClient()))
+
+	router := rabbitmq.NewRouter(log)
+	rabbitmq.NewNotificationMessageHandler(log, validator, server.newNotificationUseCase(), server.newApiKeyUseCase()).Register(router)
+	rabbitmq.NewUserEventHandler(log, server.userMessage).Register(router)
+
+	go server.purgeExpiredIdempotencyKeys()
+
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(3)
 
 	go func() {
 		defer wg.Done()
-		rabbitmq.InitConsumer(conf, log)
+		server.amqp.Run()
 	}()
 
 	go func() {
 		defer wg.Done()
-		rabbitmq.InitProducer(conf, log)
+		rabbitmq.InitConsumer(conf, log, server.amqp, server.deadLetter, router)
 	}()
 
-	return &ginServer{
-		app:       app,
-		db:        db,
-		conf:      conf,
-		log:       log,
-		validator: validator,
-	}
+	go func() {
+		defer wg.Done()
+		rabbitmq.InitProducer(log, server.amqp)
+	}()
+
+	return server
 }
 
 func (g *ginServer) Start() {
@@ -101,13 +146,37 @@ func (g *ginServer) Start() {
 		})
 	})
 	g.app.GET("/health", func(c *gin.Context) {
+		rabbitmqStatus := g.amqp.Status()
+		if rabbitmqStatus.State != rabbitmq.StateConnected {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"message":  "RabbitMQ is not connected",
+				"status":   "DEGRADED",
+				"rabbitmq": rabbitmqStatus,
+			})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
-			"message": "Service is running",
-			"status":  "OK",
+			"message":  "Service is running",
+			"status":   "OK",
+			"rabbitmq": rabbitmqStatus,
 		})
 	})
 
+	g.app.GET("/metrics", func(c *gin.Context) {
+		metrics := gin.H{
+			"websocket": websocket.GetHub().Metrics(),
+			"rabbitmq":  g.amqp.Status(),
+		}
+		if g.backplane != nil {
+			metrics["backplane"] = g.backplane.Metrics()
+		}
+		c.JSON(http.StatusOK, metrics)
+	})
+
 	g.initializeNotificationHandler()
+	g.initializeApiKeyHandler()
+	g.initializeDeadLetterHandler()
 	g.initializeWebSocketHandler()
 
 	g.log.GetLogger().Info("Server started on port " + strconv.Itoa(g.conf.Server.Port))
@@ -131,36 +200,119 @@ func (g *ginServer) GetApp() *gin.Engine {
 }
 
 func (g *ginServer) initializeNotificationHandler() {
-	hub := websocket.GetHub()
-	notificationRepository := repository.NewNotificationRepository(g.db, g.log)
-	userMessage := messaging.NewUserMessage(g.log)
-	notificationDTO := dto.NewNotificationDTO(g.log, userMessage)
-	notificationUseCase := usecase.NewNotificationUseCase(g.log, notificationDTO, notificationRepository, hub)
+	notificationUseCase := g.newNotificationUseCase()
 	notificationHandler := handler.NewNotificationHandler(g.log, g.validator, notificationUseCase)
+	jwtMiddleware := middleware.NewJWTMiddleware(g.conf, g.log)
+	apiKeyMiddleware := middleware.NewApiKeyMiddleware(g.log, g.newApiKeyUseCase())
 
 	notificationRoutes := g.app.Group("/api/v1/notifications")
-	notificationRoutes.GET("", notificationHandler.GetNotificationsByKeys)
-	notificationRoutes.GET("/all", notificationHandler.GetAllNotifications)
-	notificationRoutes.GET("/user/:user_id", notificationHandler.GetByUserID)
-	notificationRoutes.GET("/unread/count", notificationHandler.GetUnreadNotificationCount)
-	notificationRoutes.GET("/:id", notificationHandler.FindByID)
-	notificationRoutes.POST("", notificationHandler.CreateNotification)
-	notificationRoutes.PUT("/update", notificationHandler.UpdateNotification)
-	notificationRoutes.DELETE("/:id", notificationHandler.DeleteNotification)
+	notificationRoutes.POST("", apiKeyMiddleware.Authenticate(), notificationHandler.CreateNotification)
+
+	sourceRoutes := notificationRoutes.Group("/source", apiKeyMiddleware.Authenticate())
+	sourceRoutes.POST("/read", notificationHandler.MarkNotificationsReadBySource)
+	sourceRoutes.POST("/retract", notificationHandler.DeleteNotificationsBySource)
+
+	userRoutes := notificationRoutes.Group("", jwtMiddleware.Authenticate())
+	userRoutes.GET("", notificationHandler.GetNotificationsByKeys)
+	userRoutes.GET("/all", notificationHandler.GetAllNotifications)
+	userRoutes.GET("/user/:user_id", notificationHandler.GetByUserID)
+	userRoutes.GET("/unread/count", notificationHandler.GetUnreadNotificationCount)
+	userRoutes.GET("/:id", notificationHandler.FindByID)
+	userRoutes.PUT("/update", notificationHandler.UpdateNotification)
+	userRoutes.POST("/read", notificationHandler.MarkNotifications)
+	userRoutes.DELETE("/:id", notificationHandler.DeleteNotification)
 
 	g.log.GetLogger().Info("Notification routes initialized")
 }
 
+func (g *ginServer) initializeApiKeyHandler() {
+	apiKeyHandler := handler.NewApiKeyHandler(g.log, g.validator, g.newApiKeyUseCase())
+	jwtMiddleware := middleware.NewJWTMiddleware(g.conf, g.log)
+
+	apiKeyRoutes := g.app.Group("/api/v1/api-keys", jwtMiddleware.Authenticate(), middleware.RequireRole(auth.RoleAdmin))
+	apiKeyRoutes.GET("", apiKeyHandler.GetAllApiKeys)
+	apiKeyRoutes.POST("", apiKeyHandler.CreateApiKey)
+	apiKeyRoutes.DELETE("/:id", apiKeyHandler.RevokeApiKey)
+
+	g.log.GetLogger().Info("API key routes initialized")
+}
+
+func (g *ginServer) initializeDeadLetterHandler() {
+	deadLetterHandler := handler.NewDeadLetterHandler(g.log, g.deadLetter)
+	jwtMiddleware := middleware.NewJWTMiddleware(g.conf, g.log)
+
+	deadLetterRoutes := g.app.Group("/api/v1/admin/dead-letters", jwtMiddleware.Authenticate(), middleware.RequireRole(auth.RoleAdmin))
+	deadLetterRoutes.GET("", deadLetterHandler.GetDeadLetters)
+	deadLetterRoutes.POST("/replay", deadLetterHandler.ReplayDeadLetters)
+
+	g.log.GetLogger().Info("Dead letter routes initialized")
+}
+
+func (g *ginServer) newNotificationUseCase() usecase.INotificationUseCase {
+	hub := websocket.GetHub()
+	notificationRepository := repository.NewNotificationRepository(g.db, g.log)
+	idempotencyKeyRepository := repository.NewIdempotencyKeyRepository(g.db, g.log)
+	notificationDTO := dto.NewNotificationDTO(g.log, g.userMessage)
+	notificationAuthorizer := auth.NewNotificationAuthorizer(g.log)
+	return usecase.NewNotificationUseCase(g.log, g.conf, notificationDTO, notificationRepository, idempotencyKeyRepository, notificationAuthorizer, hub)
+}
+
+// purgeExpiredIdempotencyKeys deletes expired keys for the lifetime of the
+// process; a key that is reused is cleaned up on its own.
+func (g *ginServer) purgeExpiredIdempotencyKeys() {
+	interval := defaultIdempotencyPurgeInterval
+	if g.conf.Idempotency != nil && g.conf.Idempotency.PurgeInterval > 0 {
+		interval = time.Duration(g.conf.Idempotency.PurgeInterval) * time.Second
+	}
+
+	idempotencyKeyRepository := repository.NewIdempotencyKeyRepository(g.db, g.log)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deleted, err := idempotencyKeyRepository.DeleteExpiredIdempotencyKeys(time.Now())
+		if err != nil {
+			continue
+		}
+		if deleted > 0 {
+			g.log.GetLogger().Infof("Purged %d expired idempotency keys", deleted)
+		}
+	}
+}
+
+func (g *ginServer) newApiKeyUseCase() usecase.IApiKeyUseCase {
+	apiKeyRepository := repository.NewApiKeyRepository(g.db, g.log)
+	apiKeyDTO := dto.NewApiKeyDTO(g.log)
+	return usecase.NewApiKeyUseCase(g.log, apiKeyDTO, apiKeyRepository)
+}
+
 func (g *ginServer) initializeWebSocketHandler() {
 	hub := websocket.GetHub()
-	webSocketHandler := handler.NewWebSocketHandler(g.log, hub)
+	webSocketHandler := handler.NewWebSocketHandler(g.log, g.validator, hub, g.newNotificationUseCase())
+	jwtMiddleware := middleware.NewJWTMiddleware(g.conf, g.log)
 
-	webSocketRoutes := g.app.Group("/ws")
+	webSocketRoutes := g.app.Group("/ws", jwtMiddleware.Authenticate())
 	webSocketRoutes.GET("", webSocketHandler.HandleWebSocket)
 
 	g.log.GetLogger().Info("WebSocket routes initialized")
 }
 
+// logFormatter is gin's default format with the WebSocket token query
+// parameter masked, so bearer tokens never reach the access log.
+func logFormatter(param gin.LogFormatterParams) string {
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		middleware.RedactToken(param.Path),
+		param.ErrorMessage,
+	)
+}
+
 func shouldExcludeFromCSRF(path string) bool {
 	return len(path) >= 4 && path[:4] == "/api"
 }
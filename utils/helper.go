@@ -64,16 +64,19 @@ func GenerateRandomStringToken(length int) string {
 
 var ResponseChannel = make(chan map[string]interface{}, 100)
 
-var Rchans = make(map[string](chan response.RabbitMQResponse))
-
+// RabbitMsgPublisher and RabbitMsgConsumer may carry a buffered Result
+// channel that receives the outcome of the publish: nil once the broker has
+// confirmed the message, or an error when it was nacked or unroutable.
 type RabbitMsgPublisher struct {
 	QueueName string                  `json:"queueName"`
 	Message   request.RabbitMQRequest `json:"message"`
+	Result    chan error              `json:"-"`
 }
 
 type RabbitMsgConsumer struct {
 	QueueName string                    `json:"queueName"`
 	Reply     response.RabbitMQResponse `json:"reply"`
+	Result    chan error                `json:"-"`
 }
 
 // channel to publish rabbit messages